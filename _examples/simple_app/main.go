@@ -1,19 +1,18 @@
 package main
 
 import (
-	"context"
-	"crypto/rand"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	// Import the official Google OAuth2 library
 	"golang.org/x/oauth2"
 
 	// Import YOUR Monzo SDK package
 	// The import path MUST match your module path + subdirectory
-	"github.com/petermakeswebsites/go-monzo/monzo"
+	"github.com/petermakeswebsites/go-monzo/monzoauth"
 )
 
 // --- Configuration ---
@@ -27,35 +26,37 @@ const (
 	redirectURL = "http://localhost:8080/auth/callback"
 )
 
-// --- Globals ---
-
-var oauth2Config = &oauth2.Config{
-	ClientID:     clientID,
-	ClientSecret: clientSecret,
-	RedirectURL:  redirectURL,
-	Endpoint: oauth2.Endpoint{
-		AuthURL:  "https://auth.monzo.com/",
-		TokenURL: "https://api.monzo.com/oauth2/token",
-	},
-}
-
-// In a real app, this state should be stored in a short-lived,
-// encrypted cookie or user session.
-var globalState string
-
 // We'll store the token in a cookie named "monzo-token"
 const tokenCookieName = "monzo-token"
 
+// app holds everything our handlers share.
+type app struct {
+	authConfig *monzoauth.Config
+	// flow generates a fresh state for every login and checks it
+	// in the callback, so concurrent logins can't interfere.
+	flow *monzoauth.Flow
+}
+
 func main() {
+	authConfig := &monzoauth.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}
+	a := &app{
+		authConfig: authConfig,
+		flow:       monzoauth.NewFlow(authConfig),
+	}
+
 	// --- Our web server's routes ---
-	http.HandleFunc("/", handleHome)
-	http.HandleFunc("/auth/login", handleLogin)
-	http.HandleFunc("/auth/callback", handleCallback)
+	http.HandleFunc("/", a.handleHome)
+	http.HandleFunc("/auth/login", a.handleLogin)
+	http.HandleFunc("/auth/callback", a.handleCallback)
 
 	// NEW: A "safe" page to land on after the callback
-	http.HandleFunc("/dashboard", handleDashboard)
+	http.HandleFunc("/dashboard", a.handleDashboard)
 	// NEW: A way to log out
-	http.HandleFunc("/logout", handleLogout)
+	http.HandleFunc("/logout", a.handleLogout)
 
 	// --- Start the server ---
 	log.Println("Starting example server on http://localhost:8080")
@@ -66,7 +67,7 @@ func main() {
 
 // handleHome serves the home page.
 // It checks if the user is already logged in (has a cookie).
-func handleHome(w http.ResponseWriter, r *http.Request) {
+func (a *app) handleHome(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	// Check if we already have a token
@@ -91,39 +92,26 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleLogin starts the OAuth flow by redirecting the user to Monzo.
-func handleLogin(w http.ResponseWriter, r *http.Request) {
-	b := make([]byte, 16)
-	rand.Read(b)
-	globalState = hex.EncodeToString(b)
-	url := oauth2Config.AuthCodeURL(globalState)
+func (a *app) handleLogin(w http.ResponseWriter, r *http.Request) {
+	// The flow also sets a cookie, so only this browser can finish
+	// the login.
+	url, err := a.flow.AuthCodeURL(w)
+	if err != nil {
+		log.Printf("Could not start login: %v\n", err)
+		http.Error(w, "Could not start login. Please try again.", http.StatusInternalServerError)
+		return
+	}
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
 // handleCallback is the endpoint Monzo redirects to after login.
 // Its ONLY job is to exchange the code for a token and save it.
-func handleCallback(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	// 1. Check state
-	returnedState := r.FormValue("state")
-	if returnedState != globalState {
-		log.Println("Invalid state token")
-		http.Error(w, "Invalid state token.", http.StatusForbidden)
-		return
-	}
-
-	// 2. Get code
-	code := r.FormValue("code")
-	if code == "" {
-		http.Error(w, "No code returned.", http.StatusBadRequest)
-		return
-	}
-
-	// 3. Exchange for token
-	token, err := oauth2Config.Exchange(ctx, code)
+func (a *app) handleCallback(w http.ResponseWriter, r *http.Request) {
+	// 1-3. Check the state, get the code and exchange it for a token
+	token, err := a.flow.HandleCallback(r)
 	if err != nil {
-		log.Printf("Failed to exchange token: %v\n", err)
-		http.Error(w, "Failed to exchange token.", http.StatusInternalServerError)
+		log.Printf("Login failed: %v\n", err)
+		http.Error(w, "Login failed. Please try again.", http.StatusForbidden)
 		return
 	}
 
@@ -149,8 +137,8 @@ func handleCallback(w http.ResponseWriter, r *http.Request) {
 
 // handleDashboard is our new, "safe" landing page.
 // It can be refreshed without breaking the OAuth flow.
-func handleDashboard(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+func (a *app) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	// 1. Read the token from the cookie
@@ -177,31 +165,46 @@ func handleDashboard(w http.ResponseWriter, r *http.Request) {
 		// simple example, but in a real app you would!
 	}
 
-	// 3. Create the HTTP client
-	// The oauth2.Config adds the *context* (including your
-	// client_id and secret) needed to refresh the token.
-	httpClient := oauth2Config.Client(ctx, token)
-
-	// 4. Create YOUR Monzo SDK client
-	monzoClient := monzo.NewClient(httpClient)
+	// 3-4. Create YOUR Monzo SDK client
+	// The config adds your client_id and secret, which are
+	// needed to refresh the token.
+	monzoClient := a.authConfig.Client(ctx, token)
+
+	// 5. Wait for the user to approve access in the Monzo app.
+	// After a new login, every request fails with 403 until they
+	// do, so we hold the page until then. This returns straight
+	// away if they already have.
+	err = monzoauth.WaitForApproval(ctx, monzoClient, &monzoauth.ApprovalOptions{
+		Timeout: 2 * time.Minute,
+		OnWaiting: func(p monzoauth.ApprovalProgress) {
+			log.Printf("Waiting for the user to approve access (attempt %d)...\n", p.Attempt)
+		},
+	})
+	if err != nil {
+		// If they didn't approve in time, we show an error and
+		// tell the user to approve the app and refresh THIS page.
+		log.Printf("Failed to get access: %v\n", err)
+
+		fmt.Fprintln(w, "<h2>Waiting For Approval</h2>")
+		if errors.Is(err, monzoauth.ErrApprovalTimeout) {
+			fmt.Fprintln(w, "<p>You haven't approved this application yet. This is normal if it's your first time logging in.</p>")
+			fmt.Fprintln(w, "<p><b>ACTION REQUIRED:</b> Please open your Monzo app on your phone and approve this application.</p>")
+			fmt.Fprintln(w, "<p>Once approved, just refresh this page.</p>")
+		}
+		fmt.Fprintf(w, "<hr><p>Error details: %v</p>", err)
+		return
+	}
 
-	// 5. Use the client!
+	// 6. Use the client!
 	accounts, err := monzoClient.ListAccounts(ctx, "")
 	if err != nil {
-		// *** THIS IS THE NEW UX ***
-		// If it fails, we show an error and tell the user
-		// to approve the app and refresh THIS page.
-		log.Printf("Failed to list accounts (needs approval?): %v\n", err)
-
+		log.Printf("Failed to list accounts: %v\n", err)
 		fmt.Fprintln(w, "<h2>Error Fetching Accounts</h2>")
-		fmt.Fprintln(w, "<p>Could not fetch your accounts. This is normal if it's your first time logging in.</p>")
-		fmt.Fprintln(w, "<p><b>ACTION REQUIRED:</b> Please open your Monzo app on your phone and approve this application.</p>")
-		fmt.Fprintln(w, "<p>Once approved, just refresh this page.</p>")
-		fmt.Fprintf(w, "<hr><p>Error details: %v</p>", err)
+		fmt.Fprintf(w, "<p>Error details: %v</p>", err)
 		return
 	}
 
-	// 6. Success!
+	// 7. Success!
 	fmt.Fprintln(w, "<h2>Successfully Fetched Accounts!</h2>")
 	fmt.Fprintln(w, "<p>Your Accounts:</p><ul>")
 	for _, acc := range accounts {
@@ -212,7 +215,7 @@ func handleDashboard(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleLogout clears the cookie.
-func handleLogout(w http.ResponseWriter, r *http.Request) {
+func (a *app) handleLogout(w http.ResponseWriter, r *http.Request) {
 	// Expire the cookie by setting its MaxAge to -1
 	cookie := &http.Cookie{
 		Name:   tokenCookieName,
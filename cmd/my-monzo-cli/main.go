@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
-	"encoding/json"
+	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,6 +12,8 @@ import (
 	"path/filepath"
 
 	"github.com/petermakeswebsites/go-monzo/monzo"
+	"github.com/petermakeswebsites/go-monzo/monzoauth"
+	"github.com/petermakeswebsites/go-monzo/monzotest/webhooktest"
 
 	"golang.org/x/oauth2"
 )
@@ -23,33 +25,31 @@ const (
 	clientSecret = "YOUR_CLIENT_SECRET_HERE"
 	// This MUST match the "Redirect URI" you set in your Monzo client settings
 	redirectURL = "http://localhost:8080/auth/callback"
+	// loginURL is served by our temporary local server, and sends
+	// the browser on to Monzo.
+	loginURL = "http://localhost:8080/auth/login"
 )
 
 // tokenFileName is the name of the file where we'll store the token.
-const tokenFileName = "token.json"
-
-// oauth2Config holds the static configuration for our OAuth2 flow.
-var oauth2Config = &oauth2.Config{
-	ClientID:     clientID,
-	ClientSecret: clientSecret,
-	RedirectURL:  redirectURL,
-	Endpoint: oauth2.Endpoint{
-		AuthURL:  "https.auth.monzo.com/",
-		TokenURL: "https://api.monzo.com/oauth2/token",
-	},
-}
-
-// These are used to communicate between the main app and the
-// temporary web server.
-var (
-	// globalState is used to prevent CSRF attacks.
-	globalState string
-	// tokenChan receives the token from the web handler.
-	tokenChan = make(chan *oauth2.Token)
-	// errChan receives an error from the web handler.
-	errChan = make(chan error)
+// encryptedTokenFileName is used instead when tokenKeyEnv is set.
+const (
+	tokenFileName          = "token.json"
+	encryptedTokenFileName = "token.enc"
 )
 
+// tokenKeyEnv names the environment variable holding a base64-encoded
+// 32-byte key. If it's set, the token is saved encrypted.
+const tokenKeyEnv = "MONZO_TOKEN_KEY"
+
+// newAuthConfig returns the configuration for our OAuth2 flow.
+func newAuthConfig() *monzoauth.Config {
+	return &monzoauth.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
 func main() {
 	// 1. Check for command-line arguments
 	if len(os.Args) < 2 {
@@ -59,21 +59,38 @@ func main() {
 	cmd := os.Args[1]
 	ctx := context.Background()
 
+	// Commands that don't call the Monzo API run without a token.
+	if cmd == "send-webhook" {
+		runSendWebhook(ctx, os.Args[2:])
+		return
+	}
+
 	// 2. Get the API token.
-	// This will either read it from a file or start the
+	// This will either load it from the token store or start the
 	// full browser-based auth flow.
-	token, err := getCLIToken(ctx)
+	authConfig := newAuthConfig()
+	store, err := newTokenStore()
+	if err != nil {
+		log.Fatalf("Failed to open token store: %v", err)
+	}
+	token, err := getCLIToken(ctx, authConfig, store)
 	if err != nil {
 		log.Fatalf("Failed to get token: %v", err)
 	}
 
-	// 3. Create the authorized HTTP client.
-	// This client will automatically use the RefreshToken
-	// to get new AccessTokens when needed.
-	httpClient := oauth2Config.Client(ctx, token)
-
-	// 4. Create our Monzo SDK client
-	monzoClient := monzo.NewClient(httpClient)
+	// 3. Create our Monzo SDK client.
+	// Its HTTP client will automatically use the RefreshToken
+	// to get new AccessTokens when needed, and we save each
+	// refreshed token back to the store.
+	tokenSource := monzo.PersistingTokenSource(ctx, authConfig.TokenSource(ctx, token), store)
+	monzoClient := authConfig.ClientFromTokenSource(ctx, tokenSource)
+
+	// 4. Wait for the user to approve access in the Monzo app.
+	// After a new login, every request fails with 403 until
+	// they do. This returns straight away if they already have.
+	if err := waitForApproval(ctx, monzoClient); err != nil {
+		log.Fatalf("Failed to get access: %v", err)
+	}
 
 	// 5. Run the requested command
 	log.Println("---")
@@ -94,6 +111,7 @@ func printUsage() {
 	fmt.Println("Available commands:")
 	fmt.Println("  whoami         - Checks authentication and shows user/client IDs")
 	fmt.Println("  list-accounts  - Lists all your Monzo accounts")
+	fmt.Println("  send-webhook   - Sends a fake webhook to a URL (see send-webhook -h)")
 }
 
 // --- CLI Commands ---
@@ -131,155 +149,207 @@ func runListAccounts(ctx context.Context, client *monzo.Client) {
 	}
 }
 
-// --- Token & Auth Flow Management ---
+func runSendWebhook(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("send-webhook", flag.ExitOnError)
+	scenario := fs.String("scenario", string(webhooktest.ScenarioCardPayment), "scenario to send: card-payment, refund, declined or faster-payment-in")
+	accountID := fs.String("account", "acc_test", "account ID to put in the transaction")
+	updated := fs.Bool("updated", false, "also send a transaction.updated event for the transaction")
+	redeliver := fs.Int("redeliver", 0, "number of times to redeliver each event")
+	shuffle := fs.Uint64("shuffle", 0, "if non-zero, shuffle deliveries using this seed")
+	fs.Usage = func() {
+		fmt.Println("Usage: my-monzo-cli send-webhook [flags] <url>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	target := fs.Arg(0)
 
-// getCLIToken is the core auth logic for the CLI.
-// It tries to read a token from a file. If it can't, it
-// starts the browser-based auth flow.
-func getCLIToken(ctx context.Context) (*oauth2.Token, error) {
-	tokenPath, err := getTokenPath()
+	tx, err := webhooktest.ScenarioTransaction(webhooktest.Scenario(*scenario), *accountID)
 	if err != nil {
-		return nil, fmt.Errorf("could not get token path: %w", err)
+		log.Fatalf("Failed to build webhook: %v", err)
 	}
+	created, err := webhooktest.NewWebhookEvent(monzo.WebhookTransactionCreated, tx)
+	if err != nil {
+		log.Fatalf("Failed to build webhook: %v", err)
+	}
+	events := []*monzo.WebhookEvent{created}
+	if *updated {
+		tx.Settled = monzo.NullableTime{Time: tx.Created}
+		tx.AmountIsPending = false
+		event, err := webhooktest.NewWebhookEvent(monzo.WebhookTransactionUpdated, tx)
+		if err != nil {
+			log.Fatalf("Failed to build webhook: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	opts := []webhooktest.SendOption{webhooktest.WithRedeliveries(*redeliver)}
+	if *shuffle != 0 {
+		opts = append(opts, webhooktest.WithShuffle(*shuffle))
+	}
+
+	log.Printf("Sending %s webhook for %s to %s...\n", *scenario, tx.ID, target)
+	deliveries, err := webhooktest.SendWebhooks(ctx, target, events, opts...)
+	if err != nil {
+		log.Fatalf("Failed to send webhooks: %v", err)
+	}
+	for _, d := range deliveries {
+		if d.Err != nil {
+			fmt.Printf("  - %s (attempt %d): error: %v\n", d.Event.Type, d.Attempt, d.Err)
+			continue
+		}
+		fmt.Printf("  - %s (attempt %d): %d %s\n", d.Event.Type, d.Attempt, d.StatusCode, http.StatusText(d.StatusCode))
+	}
+}
 
-	// Try to read the token from the file
-	token, err := readToken(tokenPath)
+// --- Token & Auth Flow Management ---
+
+// getCLIToken is the core auth logic for the CLI.
+// It tries to load a token from the store. If there isn't one,
+// it starts the browser-based auth flow.
+func getCLIToken(ctx context.Context, authConfig *monzoauth.Config, store monzo.TokenStore) (*oauth2.Token, error) {
+	// Try to load the saved token
+	token, err := store.Load(ctx)
 	if err == nil {
-		log.Println("Using saved token from:", tokenPath)
+		log.Println("Using saved token.")
 		// We have a token. We're done.
 		return token, nil
 	}
+	if !errors.Is(err, monzo.ErrNoToken) {
+		// The token file exists but can't be read, e.g. because
+		// it was encrypted with a different key.
+		log.Printf("Could not load saved token: %v", err)
+	}
 
-	// No token file found, or it's invalid.
+	// No saved token, or it's invalid.
 	// Start the full auth flow.
-	log.Println("No valid token file found. Starting browser authentication...")
+	log.Println("No valid saved token found. Starting browser authentication...")
+	token, err = login(ctx, authConfig)
+	if err != nil {
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+	log.Println("Authentication successful!")
+
+	// Save the new token
+	log.Println("Saving token.")
+	if err := store.Save(ctx, token); err != nil {
+		return nil, fmt.Errorf("failed to save new token: %w", err)
+	}
+	return token, nil
+}
+
+// waitForApproval waits for the user to approve access in the
+// Monzo app, reminding them while it waits.
+func waitForApproval(ctx context.Context, client *monzo.Client) error {
+	err := monzoauth.WaitForApproval(ctx, client, &monzoauth.ApprovalOptions{
+		OnWaiting: func(p monzoauth.ApprovalProgress) {
+			if p.Attempt == 1 {
+				log.Println("---")
+				log.Println("ACTION REQUIRED: Please open your Monzo app on your phone and approve this application.")
+				log.Println("---")
+			}
+			log.Printf("Waiting for approval... (checking again in %s)\n", p.NextPoll)
+		},
+	})
+	if errors.Is(err, monzoauth.ErrApprovalTimeout) {
+		return fmt.Errorf("access wasn't approved in the Monzo app in time, please run the command again: %w", err)
+	}
+	return err
+}
+
+// callbackResult is what the temporary web server's callback
+// handler hands back to login.
+type callbackResult struct {
+	token *oauth2.Token
+	err   error
+}
+
+// login runs the browser-based auth flow. It starts a temporary
+// local server to catch Monzo's redirect, and shuts it down once
+// the login is done.
+func login(ctx context.Context, authConfig *monzoauth.Config) (*oauth2.Token, error) {
+	flow := monzoauth.NewFlow(authConfig)
+	results := make(chan callbackResult, 1)
 
 	// 1. Start the temporary local server in the background
-	http.HandleFunc("/auth/callback", handleAuthCallback)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		// Send the browser to Monzo from here, so the flow can set
+		// its state cookie.
+		url, err := flow.AuthCodeURL(w)
+		if err != nil {
+			http.Error(w, "Could not start login. Please return to your terminal.", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, url, http.StatusFound)
+	})
+	mux.HandleFunc("/auth/callback", func(w http.ResponseWriter, r *http.Request) {
+		// The flow checks the state and exchanges the code.
+		token, err := flow.HandleCallback(r)
+		if err != nil {
+			log.Println("Login failed:", err)
+			http.Error(w, "Login failed. Please return to your terminal.", http.StatusForbidden)
+		} else {
+			log.Println("Token received by local server.")
+			fmt.Fprintln(w, "Authentication successful! You can close this window and return to your terminal.")
+		}
+		select {
+		case results <- callbackResult{token, err}:
+		default: // A result has already been delivered.
+		}
+	})
+	server := &http.Server{Addr: ":8080", Handler: mux}
 	go func() {
-		// This will block until the server gets the /auth/callback request
-		if err := http.ListenAndServe(":8080", nil); err != http.ErrServerClosed {
-			errChan <- err
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			select {
+			case results <- callbackResult{err: err}:
+			default:
+			}
 		}
 	}()
+	defer server.Close()
 
-	// 2. Generate a state token
-	b := make([]byte, 16)
-	rand.Read(b)
-	globalState = hex.EncodeToString(b)
-	authURL := oauth2Config.AuthCodeURL(globalState)
-
-	// 3. Tell the user to open the URL
+	// 2. Tell the user to open the URL
 	log.Println("---")
 	log.Println("Please open this URL in your browser to log in:")
-	fmt.Printf("\n%s\n\n", authURL)
+	fmt.Printf("\n%s\n\n", loginURL)
 	log.Println("Waiting for authentication...")
 	log.Println("(This will start a local server on port 8080 to catch the redirect)")
 	log.Println("---")
 
-	// 4. Wait for the token or an error from the web handler
+	// 3. Wait for the token or an error from the web handler
 	select {
-	case token := <-tokenChan:
-		log.Println("Authentication successful!")
-		// 5. Save the new token
-		if err := saveToken(tokenPath, token); err != nil {
-			return nil, fmt.Errorf("failed to save new token: %w", err)
-		}
-		return token, nil
-	case err := <-errChan:
-		return nil, fmt.Errorf("authentication failed: %w", err)
+	case result := <-results:
+		return result.token, result.err
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
-// handleAuthCallback is the HTTP handler for our temporary server.
-// It runs when Monzo redirects the user back to localhost.
-func handleAuthCallback(w http.ResponseWriter, r *http.Request) {
-	// 1. Check the state
-	returnedState := r.FormValue("state")
-	if returnedState != globalState {
-		msg := "Invalid state token"
-		log.Println(msg)
-		http.Error(w, msg, http.StatusForbidden)
-		errChan <- fmt.Errorf(msg)
-		return
-	}
-
-	// 2. Get the code
-	code := r.FormValue("code")
-	if code == "" {
-		msg := "No code returned"
-		log.Println(msg)
-		http.Error(w, msg, http.StatusBadRequest)
-		errChan <- fmt.Errorf(msg)
-		return
-	}
-
-	// 3. Exchange the code for a token
-	// We use context.Background() here because this handler's
-	// request context (r.Context()) will be cancelled when
-	// the server shuts down, but we need the token exchange
-	// to complete.
-	token, err := oauth2Config.Exchange(context.Background(), code)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to exchange token: %v", err)
-		log.Println(msg)
-		http.Error(w, msg, http.StatusInternalServerError)
-		errChan <- fmt.Errorf(msg)
-		return
-	}
-
-	// 4. Send the token back to the main app
-	log.Println("Token received by local server.")
-	fmt.Fprintln(w, "Authentication successful! You can close this window and return to your terminal.")
-	tokenChan <- token
-}
-
 // --- File Helpers ---
 
-// getTokenPath finds the OS-specific config directory and returns
-// the full path for our token file.
-func getTokenPath() (string, error) {
+// newTokenStore returns the store for our token, in the OS-specific
+// config directory. If MONZO_TOKEN_KEY is set, the token is encrypted
+// with it.
+func newTokenStore() (monzo.TokenStore, error) {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("could not get config directory: %w", err)
 	}
 	// e.g., /home/user/.config/my-monzo-cli/token.json
 	// or C:\Users\user\AppData\Roaming\my-monzo-cli\token.json
-	return filepath.Join(configDir, "my-monzo-cli", tokenFileName), nil
-}
+	dir := filepath.Join(configDir, "my-monzo-cli")
 
-// readToken loads a token from a JSON file.
-func readToken(path string) (*oauth2.Token, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
+	encodedKey := os.Getenv(tokenKeyEnv)
+	if encodedKey == "" {
+		return monzo.NewFileTokenStore(filepath.Join(dir, tokenFileName)), nil
 	}
-	defer file.Close()
-
-	var token oauth2.Token
-	if err := json.NewDecoder(file).Decode(&token); err != nil {
-		return nil, err
-	}
-	return &token, nil
-}
-
-// saveToken saves a token to a JSON file, creating directories if needed.
-func saveToken(path string, token *oauth2.Token) error {
-	log.Println("Saving token to:", path)
-	// Create the directory (e.g., ~/.config/my-monzo-cli)
-	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
-		return err
-	}
-
-	// Create the file
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("%s is not valid base64: %w", tokenKeyEnv, err)
 	}
-	defer file.Close()
-
-	// Write the token as JSON
-	return json.NewEncoder(file).Encode(token)
+	return monzo.NewEncryptedFileTokenStore(filepath.Join(dir, encryptedTokenFileName), key)
 }
@@ -0,0 +1,141 @@
+package monzo
+
+// The enum types in this file are plain strings underneath, so they encode
+// to and decode from JSON as strings. Values that Monzo adds after this
+// package was written decode without error and round-trip unchanged;
+// IsKnown reports whether a value is one of the constants below.
+
+// Category is a transaction spending category.
+type Category string
+
+// Known transaction categories.
+const (
+	CategoryGeneral       Category = "general"
+	CategoryEatingOut     Category = "eating_out"
+	CategoryExpenses      Category = "expenses"
+	CategoryTransport     Category = "transport"
+	CategoryCash          Category = "cash"
+	CategoryBills         Category = "bills"
+	CategoryEntertainment Category = "entertainment"
+	CategoryShopping      Category = "shopping"
+	CategoryHolidays      Category = "holidays"
+	CategoryGroceries     Category = "groceries"
+	CategoryPersonalCare  Category = "personal_care"
+	CategoryFamily        Category = "family"
+	CategoryCharity       Category = "charity"
+	CategoryFinances      Category = "finances"
+	CategoryGifts         Category = "gifts"
+	CategoryIncome        Category = "income"
+	CategorySavings       Category = "savings"
+	CategoryTransfers     Category = "transfers"
+)
+
+var knownCategories = map[Category]bool{
+	CategoryGeneral: true, CategoryEatingOut: true, CategoryExpenses: true,
+	CategoryTransport: true, CategoryCash: true, CategoryBills: true,
+	CategoryEntertainment: true, CategoryShopping: true, CategoryHolidays: true,
+	CategoryGroceries: true, CategoryPersonalCare: true, CategoryFamily: true,
+	CategoryCharity: true, CategoryFinances: true, CategoryGifts: true,
+	CategoryIncome: true, CategorySavings: true, CategoryTransfers: true,
+}
+
+// String returns the category as sent by the API, e.g. "eating_out".
+func (c Category) String() string { return string(c) }
+
+// IsKnown reports whether c is one of the Category constants.
+func (c Category) IsKnown() bool { return knownCategories[c] }
+
+// AccountType is the type of a Monzo account.
+type AccountType string
+
+// Known account types.
+const (
+	AccountTypeUKRetail      AccountType = "uk_retail"
+	AccountTypeUKRetailJoint AccountType = "uk_retail_joint"
+	AccountTypeUKBusiness    AccountType = "uk_business"
+	AccountTypeUKMonzoFlex   AccountType = "uk_monzo_flex"
+	AccountTypeUKRewards     AccountType = "uk_rewards"
+	AccountTypeUKPrepaid     AccountType = "uk_prepaid"
+)
+
+var knownAccountTypes = map[AccountType]bool{
+	AccountTypeUKRetail: true, AccountTypeUKRetailJoint: true,
+	AccountTypeUKBusiness: true, AccountTypeUKMonzoFlex: true,
+	AccountTypeUKRewards: true, AccountTypeUKPrepaid: true,
+}
+
+// String returns the account type as sent by the API, e.g. "uk_retail".
+func (t AccountType) String() string { return string(t) }
+
+// IsKnown reports whether t is one of the AccountType constants.
+func (t AccountType) IsKnown() bool { return knownAccountTypes[t] }
+
+// ProductType is the product an account belongs to.
+type ProductType string
+
+// Known account product types.
+const (
+	ProductTypeStandard ProductType = "standard"
+	ProductTypeFlex     ProductType = "flex"
+	ProductTypeRewards  ProductType = "rewards"
+	ProductTypeBusiness ProductType = "business"
+)
+
+var knownProductTypes = map[ProductType]bool{
+	ProductTypeStandard: true, ProductTypeFlex: true,
+	ProductTypeRewards: true, ProductTypeBusiness: true,
+}
+
+// String returns the product type as sent by the API, e.g. "flex".
+func (t ProductType) String() string { return string(t) }
+
+// IsKnown reports whether t is one of the ProductType constants.
+func (t ProductType) IsKnown() bool { return knownProductTypes[t] }
+
+// PotStyle is the visual style of a pot.
+type PotStyle string
+
+// Known pot styles.
+const (
+	PotStyleBeachBall PotStyle = "beach_ball"
+	PotStyleBlue      PotStyle = "blue"
+	PotStyleGreen     PotStyle = "green"
+	PotStyleOrange    PotStyle = "orange"
+	PotStylePink      PotStyle = "pink"
+	PotStylePurple    PotStyle = "purple"
+	PotStyleRed       PotStyle = "red"
+	PotStyleTeal      PotStyle = "teal"
+	PotStyleYellow    PotStyle = "yellow"
+)
+
+var knownPotStyles = map[PotStyle]bool{
+	PotStyleBeachBall: true, PotStyleBlue: true, PotStyleGreen: true,
+	PotStyleOrange: true, PotStylePink: true, PotStylePurple: true,
+	PotStyleRed: true, PotStyleTeal: true, PotStyleYellow: true,
+}
+
+// String returns the pot style as sent by the API, e.g. "beach_ball".
+func (s PotStyle) String() string { return string(s) }
+
+// IsKnown reports whether s is one of the PotStyle constants.
+func (s PotStyle) IsKnown() bool { return knownPotStyles[s] }
+
+// PaymentType is how a receipt was paid for.
+type PaymentType string
+
+// Known receipt payment types.
+const (
+	PaymentTypeCard     PaymentType = "card"
+	PaymentTypeCash     PaymentType = "cash"
+	PaymentTypeGiftCard PaymentType = "gift_card"
+)
+
+var knownPaymentTypes = map[PaymentType]bool{
+	PaymentTypeCard: true, PaymentTypeCash: true, PaymentTypeGiftCard: true,
+}
+
+// String returns the payment type as sent by the API, e.g. "card".
+func (t PaymentType) String() string { return string(t) }
+
+// IsKnown reports whether t is one of the PaymentType constants.
+func (t PaymentType) IsKnown() bool { return knownPaymentTypes[t] }
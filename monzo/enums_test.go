@@ -0,0 +1,74 @@
+package monzo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestEnums_IsKnown(t *testing.T) {
+	if !CategoryEatingOut.IsKnown() || Category("time_travel").IsKnown() {
+		t.Error("unexpected Category.IsKnown result")
+	}
+	if !AccountTypeUKRetailJoint.IsKnown() || AccountType("uk_retial").IsKnown() {
+		t.Error("unexpected AccountType.IsKnown result")
+	}
+	if !PotStyleBeachBall.IsKnown() || PotStyle("disco_ball").IsKnown() {
+		t.Error("unexpected PotStyle.IsKnown result")
+	}
+	if !PaymentTypeGiftCard.IsKnown() || PaymentType("barter").IsKnown() {
+		t.Error("unexpected PaymentType.IsKnown result")
+	}
+	if CategoryPersonalCare.String() != "personal_care" {
+		t.Errorf("expected 'personal_care', got %s", CategoryPersonalCare.String())
+	}
+}
+
+func TestEnums_UnknownValuesRoundTrip(t *testing.T) {
+	input := `{"id":"tx_001","category":"time_travel","categories":{"time_travel":-100,"eating_out":-50}}`
+
+	var tx Transaction
+	if err := json.Unmarshal([]byte(input), &tx); err != nil {
+		t.Fatalf("Unmarshal returned an error: %v", err)
+	}
+	if tx.Category != "time_travel" || tx.Category.IsKnown() {
+		t.Errorf("expected unknown category 'time_travel', got %s", tx.Category)
+	}
+	if tx.Categories[CategoryEatingOut] != -50 {
+		t.Errorf("expected eating_out split -50, got %d", tx.Categories[CategoryEatingOut])
+	}
+
+	out, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Marshal returned an error: %v", err)
+	}
+	var again Transaction
+	if err := json.Unmarshal(out, &again); err != nil {
+		t.Fatalf("Unmarshal returned an error: %v", err)
+	}
+	if again.Category != tx.Category || again.Categories["time_travel"] != -100 {
+		t.Errorf("expected unknown category to round-trip, got %s / %v", again.Category, again.Categories)
+	}
+}
+
+func TestListAccounts_AccountType(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("account_type"); got != "uk_retail_joint" {
+			t.Errorf("expected account_type 'uk_retail_joint', got %s", got)
+		}
+		fmt.Fprint(w, `{"accounts": [{"id": "acc_001", "type": "uk_retail_joint"}]}`)
+	})
+
+	accounts, err := client.ListAccounts(context.Background(), AccountTypeUKRetailJoint)
+	if err != nil {
+		t.Fatalf("ListAccounts returned an error: %v", err)
+	}
+	if accounts[0].Type != AccountTypeUKRetailJoint {
+		t.Errorf("expected type uk_retail_joint, got %s", accounts[0].Type)
+	}
+}
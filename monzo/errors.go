@@ -0,0 +1,180 @@
+package monzo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors for matching API failures with errors.Is. An *APIError
+// matches the sentinel for its HTTP status code, and the code-based
+// sentinels (ErrInsufficientPermissions, ErrInsufficientFunds,
+// ErrHistoryWindowExpired) when Monzo's error code says so.
+//
+//	if errors.Is(err, monzo.ErrInsufficientPermissions) {
+//		// Ask the user to approve access in the Monzo app.
+//	}
+var (
+	// ErrBadRequest matches 400 Bad Request responses.
+	ErrBadRequest = errors.New("monzo: bad request")
+	// ErrUnauthorized matches 401 Unauthorized responses.
+	ErrUnauthorized = errors.New("monzo: unauthorized")
+	// ErrForbidden matches 403 Forbidden responses.
+	ErrForbidden = errors.New("monzo: forbidden")
+	// ErrNotFound matches 404 Not Found responses.
+	ErrNotFound = errors.New("monzo: not found")
+	// ErrMethodNotAllowed matches 405 Method Not Allowed responses.
+	ErrMethodNotAllowed = errors.New("monzo: method not allowed")
+	// ErrRateLimited matches 429 Too Many Requests responses.
+	ErrRateLimited = errors.New("monzo: rate limited")
+	// ErrServerError matches any 5xx response.
+	ErrServerError = errors.New("monzo: server error")
+
+	// ErrInsufficientPermissions matches errors with the code
+	// "forbidden.insufficient_permissions". Monzo returns this until the
+	// user has approved access in the Monzo app.
+	ErrInsufficientPermissions = errors.New("monzo: insufficient permissions")
+	// ErrInsufficientFunds matches errors whose code reports insufficient
+	// funds, e.g. when depositing more into a pot than the account holds.
+	ErrInsufficientFunds = errors.New("monzo: insufficient funds")
+)
+
+// APIError represents an error returned from the Monzo API.
+//
+// It includes the HTTP status code and the raw response body. If the body
+// is Monzo's JSON error envelope, its code, message and params are also
+// decoded into the corresponding fields.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Body is the raw response body.
+	Body string
+	// Code is Monzo's dotted error code, e.g.
+	// "forbidden.insufficient_permissions". Empty if the body was not a
+	// JSON error envelope.
+	Code string
+	// Message is the human-readable error message.
+	Message string
+	// Params holds any additional parameters Monzo attached to the error.
+	Params map[string]string
+}
+
+// errorEnvelope is the JSON shape of a Monzo error response.
+type errorEnvelope struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// newAPIError builds an APIError from a failed response, decoding Monzo's
+// error envelope if the body contains one.
+func newAPIError(statusCode int, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: statusCode,
+		Body:       string(body),
+	}
+
+	var env errorEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return e
+	}
+	e.Code = env.Code
+	e.Message = env.Message
+	e.Params = decodeErrorParams(env.Params)
+	return e
+}
+
+// decodeErrorParams decodes error params into a string map. Params are
+// usually strings, but any other JSON values are kept in their JSON form.
+func decodeErrorParams(raw json.RawMessage) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &params); err != nil || len(params) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(params))
+	for k, v := range params {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			out[k] = s
+		} else {
+			out[k] = string(v)
+		}
+	}
+	return out
+}
+
+// Error implements the error interface for APIError.
+func (e *APIError) Error() string {
+	switch {
+	case e.Code != "" && e.Message != "":
+		return fmt.Sprintf("monzo: API error (status %d, code %s): %s", e.StatusCode, e.Code, e.Message)
+	case e.Code != "":
+		return fmt.Sprintf("monzo: API error (status %d, code %s)", e.StatusCode, e.Code)
+	default:
+		return fmt.Sprintf("monzo: API error (status %d): %s", e.StatusCode, e.Body)
+	}
+}
+
+// Is reports whether the error matches one of the package's sentinel
+// errors, allowing errors.Is(err, monzo.ErrNotFound) and friends.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrMethodNotAllowed:
+		return e.StatusCode == http.StatusMethodNotAllowed
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServerError:
+		return e.StatusCode >= 500
+	case ErrInsufficientPermissions:
+		return e.hasCodeSegment("insufficient_permissions")
+	case ErrInsufficientFunds:
+		return e.hasCodeSegment("insufficient_funds")
+	case ErrHistoryWindowExpired:
+		return e.StatusCode == http.StatusForbidden && e.Code == "forbidden.verification_required"
+	}
+	return false
+}
+
+// hasCodeSegment reports whether one of the dot-separated parts of the
+// error code equals seg.
+func (e *APIError) hasCodeSegment(seg string) bool {
+	for part := range strings.SplitSeq(e.Code, ".") {
+		if part == seg {
+			return true
+		}
+	}
+	return false
+}
+
+// AsAPIError returns the *APIError in err's chain, if there is one.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsTokenExpired reports whether err is a 401 caused by an expired access
+// token, e.g. code "unauthorized.bad_access_token.expired". The token
+// should be refreshed, or the user sent through the OAuth flow again.
+func IsTokenExpired(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	return strings.HasPrefix(apiErr.Code, "unauthorized.") && apiErr.hasCodeSegment("expired")
+}
@@ -0,0 +1,116 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAPIError_DecodesEnvelope(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mockErrorResponse := `
+	{
+		"code": "forbidden.insufficient_permissions",
+		"message": "Access forbidden due to insufficient permissions",
+		"params": {
+			"client_id": "oauth2client_001",
+			"user_id": "user_001",
+			"retry_count": 2
+		}
+	}`
+
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, mockErrorResponse)
+	})
+
+	_, err := client.ListAccounts(context.Background(), "")
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		t.Fatalf("expected an *APIError, got %T", err)
+	}
+
+	if apiErr.Code != "forbidden.insufficient_permissions" {
+		t.Errorf("expected code 'forbidden.insufficient_permissions', got %s", apiErr.Code)
+	}
+	if apiErr.Message != "Access forbidden due to insufficient permissions" {
+		t.Errorf("unexpected message: %s", apiErr.Message)
+	}
+	if apiErr.Params["user_id"] != "user_001" {
+		t.Errorf("expected param user_id 'user_001', got %s", apiErr.Params["user_id"])
+	}
+	if apiErr.Params["retry_count"] != "2" {
+		t.Errorf("expected param retry_count '2', got %s", apiErr.Params["retry_count"])
+	}
+
+	if !errors.Is(err, ErrForbidden) {
+		t.Error("expected errors.Is(err, ErrForbidden) to be true")
+	}
+	if !errors.Is(err, ErrInsufficientPermissions) {
+		t.Error("expected errors.Is(err, ErrInsufficientPermissions) to be true")
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		t.Error("expected errors.Is(err, ErrUnauthorized) to be false")
+	}
+}
+
+func TestAPIError_NonJSONBody(t *testing.T) {
+	apiErr := newAPIError(http.StatusBadGateway, []byte("<html>Bad Gateway</html>"))
+
+	if apiErr.Code != "" || apiErr.Message != "" {
+		t.Errorf("expected no code or message, got %q / %q", apiErr.Code, apiErr.Message)
+	}
+	if apiErr.Body != "<html>Bad Gateway</html>" {
+		t.Errorf("expected raw body to be kept, got %s", apiErr.Body)
+	}
+	if !errors.Is(apiErr, ErrServerError) {
+		t.Error("expected errors.Is(err, ErrServerError) to be true")
+	}
+}
+
+func TestAPIError_Sentinels(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+		target error
+		want   bool
+	}{
+		{http.StatusBadRequest, "bad_request", ErrBadRequest, true},
+		{http.StatusUnauthorized, "unauthorized.bad_access_token", ErrUnauthorized, true},
+		{http.StatusNotFound, "not_found", ErrNotFound, true},
+		{http.StatusMethodNotAllowed, "", ErrMethodNotAllowed, true},
+		{http.StatusTooManyRequests, "", ErrRateLimited, true},
+		{http.StatusServiceUnavailable, "", ErrServerError, true},
+		{http.StatusBadRequest, "bad_request.insufficient_funds", ErrInsufficientFunds, true},
+		{http.StatusBadRequest, "bad_request.insufficient_funds", ErrNotFound, false},
+		{http.StatusForbidden, "forbidden", ErrInsufficientPermissions, false},
+	}
+	for _, tt := range tests {
+		body := fmt.Sprintf(`{"code": %q}`, tt.code)
+		err := error(newAPIError(tt.status, []byte(body)))
+		if got := errors.Is(fmt.Errorf("wrapped: %w", err), tt.target); got != tt.want {
+			t.Errorf("status %d code %q: errors.Is(%v) = %v, want %v", tt.status, tt.code, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestIsTokenExpired(t *testing.T) {
+	expired := newAPIError(http.StatusUnauthorized, []byte(`{"code": "unauthorized.bad_access_token.expired"}`))
+	if !IsTokenExpired(fmt.Errorf("wrapped: %w", expired)) {
+		t.Error("expected IsTokenExpired to be true for an expired access token")
+	}
+
+	invalid := newAPIError(http.StatusUnauthorized, []byte(`{"code": "unauthorized.bad_access_token"}`))
+	if IsTokenExpired(invalid) {
+		t.Error("expected IsTokenExpired to be false for a bad access token")
+	}
+
+	if IsTokenExpired(errors.New("some other error")) {
+		t.Error("expected IsTokenExpired to be false for a non-API error")
+	}
+}
@@ -0,0 +1,101 @@
+package monzo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// FullHistoryWindow is how long after authentication a token can read
+	// a user's full transaction history. After that, only transactions
+	// from the last HistoryWindow are available.
+	FullHistoryWindow = 5 * time.Minute
+	// HistoryWindow is how far back transactions can be listed once the
+	// FullHistoryWindow has closed.
+	HistoryWindow = 90 * 24 * time.Hour
+
+	// historyClampMargin is kept between a clamped Since and the edge of
+	// the HistoryWindow, to allow for clock skew between us and Monzo.
+	historyClampMargin = 10 * time.Minute
+)
+
+// ErrHistoryWindowExpired is returned when transactions older than the
+// HistoryWindow are requested after the FullHistoryWindow has closed.
+// Re-authenticate to read older transactions, or use WithHistoryClamp to
+// limit requests to the available window.
+var ErrHistoryWindowExpired = errors.New("monzo: transaction history window expired")
+
+// FullHistoryRemaining returns how long a token authenticated at
+// authenticatedAt can still read the full transaction history, or zero
+// if the window has closed.
+func FullHistoryRemaining(authenticatedAt time.Time) time.Duration {
+	remaining := time.Until(authenticatedAt.Add(FullHistoryWindow))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// WithHistoryClamp makes ListTransactions and Transactions move a Since
+// timestamp that falls outside the HistoryWindow forward to the start of
+// the window, instead of failing with ErrHistoryWindowExpired.
+//
+// authenticatedAt is when the client's token was obtained; no clamping is
+// done while the FullHistoryWindow is still open. Pass the zero time if
+// it's unknown to always clamp. Since values that are transaction IDs are
+// never changed.
+func WithHistoryClamp(authenticatedAt time.Time) Option {
+	return func(c *Client) {
+		c.historyClamp = true
+		c.authenticatedAt = authenticatedAt
+	}
+}
+
+// historyWindowStart returns the oldest time transactions can be listed
+// from at now, once the FullHistoryWindow has closed.
+func historyWindowStart(now time.Time) time.Time {
+	return now.Add(-HistoryWindow)
+}
+
+// clampSince returns options with Since moved into the HistoryWindow if
+// the client is configured to clamp and it needs to be. The caller's
+// options are never modified.
+func (c *Client) clampSince(options *PaginationOptions) *PaginationOptions {
+	if !c.historyClamp || options == nil || options.Since == "" {
+		return options
+	}
+	if !c.authenticatedAt.IsZero() && FullHistoryRemaining(c.authenticatedAt) > 0 {
+		return options
+	}
+	since, err := time.Parse(time.RFC3339, options.Since)
+	if err != nil {
+		// A transaction ID, which we can't reason about.
+		return options
+	}
+
+	earliest := historyWindowStart(time.Now()).Add(historyClampMargin)
+	if !since.Before(earliest) {
+		return options
+	}
+	clamped := *options
+	clamped.Since = earliest.UTC().Format(time.RFC3339)
+	return &clamped
+}
+
+// historyError converts a 403 from ListTransactions into an error matching
+// ErrHistoryWindowExpired when the request reached back beyond the
+// HistoryWindow. Other errors are returned unchanged.
+func historyError(err error, options *PaginationOptions) error {
+	if !errors.Is(err, ErrForbidden) || errors.Is(err, ErrHistoryWindowExpired) {
+		return err
+	}
+	if options == nil || options.Since == "" {
+		return err
+	}
+	since, parseErr := time.Parse(time.RFC3339, options.Since)
+	if parseErr != nil || !since.Before(historyWindowStart(time.Now())) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrHistoryWindowExpired, err)
+}
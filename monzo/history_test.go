@@ -0,0 +1,135 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestListTransactions_HistoryWindowExpired(t *testing.T) {
+	t.Run("verification required code", func(t *testing.T) {
+		client, mux, teardown := setup(t)
+		defer teardown()
+
+		mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"code": "forbidden.verification_required", "message": "Verification required"}`)
+		})
+
+		_, err := client.ListTransactions(context.Background(), "acc_001", nil)
+		if !errors.Is(err, ErrHistoryWindowExpired) {
+			t.Errorf("expected ErrHistoryWindowExpired, got %v", err)
+		}
+	})
+
+	t.Run("forbidden for an old since", func(t *testing.T) {
+		client, mux, teardown := setup(t)
+		defer teardown()
+
+		mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"code": "forbidden", "message": "Forbidden"}`)
+		})
+
+		old := time.Now().Add(-200 * 24 * time.Hour).UTC().Format(time.RFC3339)
+		_, err := client.ListTransactions(context.Background(), "acc_001", &PaginationOptions{Since: old})
+		if !errors.Is(err, ErrHistoryWindowExpired) {
+			t.Errorf("expected ErrHistoryWindowExpired, got %v", err)
+		}
+		if _, ok := AsAPIError(err); !ok {
+			t.Error("expected the underlying *APIError to be kept")
+		}
+	})
+
+	t.Run("forbidden for a recent since", func(t *testing.T) {
+		client, mux, teardown := setup(t)
+		defer teardown()
+
+		mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"code": "forbidden.insufficient_permissions"}`)
+		})
+
+		recent := time.Now().Add(-24 * time.Hour).UTC().Format(time.RFC3339)
+		_, err := client.ListTransactions(context.Background(), "acc_001", &PaginationOptions{Since: recent})
+		if errors.Is(err, ErrHistoryWindowExpired) {
+			t.Errorf("expected a plain forbidden error, got %v", err)
+		}
+	})
+}
+
+func TestWithHistoryClamp(t *testing.T) {
+	old := time.Now().Add(-200 * 24 * time.Hour).UTC().Format(time.RFC3339)
+
+	t.Run("clamps an old since", func(t *testing.T) {
+		client, mux, teardown := setup(t, WithHistoryClamp(time.Time{}))
+		defer teardown()
+
+		var since string
+		mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+			since = r.URL.Query().Get("since")
+			fmt.Fprint(w, `{"transactions": []}`)
+		})
+
+		opts := &PaginationOptions{Since: old}
+		if _, err := client.ListTransactions(context.Background(), "acc_001", opts); err != nil {
+			t.Fatalf("ListTransactions returned an error: %v", err)
+		}
+
+		got, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			t.Fatalf("expected an RFC3339 since, got %q", since)
+		}
+		if got.Before(time.Now().Add(-HistoryWindow)) {
+			t.Errorf("expected since to be clamped into the history window, got %s", since)
+		}
+		if opts.Since != old {
+			t.Error("expected the caller's options to be left unchanged")
+		}
+	})
+
+	t.Run("leaves since alone while full history is open", func(t *testing.T) {
+		client, mux, teardown := setup(t, WithHistoryClamp(time.Now()))
+		defer teardown()
+
+		mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("since"); got != old {
+				t.Errorf("expected since %s, got %s", old, got)
+			}
+			fmt.Fprint(w, `{"transactions": []}`)
+		})
+
+		if _, err := client.ListTransactions(context.Background(), "acc_001", &PaginationOptions{Since: old}); err != nil {
+			t.Fatalf("ListTransactions returned an error: %v", err)
+		}
+	})
+
+	t.Run("leaves transaction IDs alone", func(t *testing.T) {
+		client, mux, teardown := setup(t, WithHistoryClamp(time.Time{}))
+		defer teardown()
+
+		mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("since"); got != "tx_001" {
+				t.Errorf("expected since tx_001, got %s", got)
+			}
+			fmt.Fprint(w, `{"transactions": []}`)
+		})
+
+		if _, err := client.ListTransactions(context.Background(), "acc_001", &PaginationOptions{Since: "tx_001"}); err != nil {
+			t.Fatalf("ListTransactions returned an error: %v", err)
+		}
+	})
+}
+
+func TestFullHistoryRemaining(t *testing.T) {
+	if got := FullHistoryRemaining(time.Now().Add(-time.Hour)); got != 0 {
+		t.Errorf("expected 0 for an old token, got %s", got)
+	}
+	got := FullHistoryRemaining(time.Now().Add(-time.Minute))
+	if got <= 3*time.Minute || got > 4*time.Minute {
+		t.Errorf("expected about 4 minutes remaining, got %s", got)
+	}
+}
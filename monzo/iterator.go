@@ -0,0 +1,106 @@
+package monzo
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// MaxPageSize is the largest page the Monzo API returns from a single
+// ListTransactions call.
+const MaxPageSize = 100
+
+// TransactionsOptions controls the iterator returned by Client.Transactions.
+type TransactionsOptions struct {
+	// PageSize is the number of transactions fetched per request.
+	// It defaults to, and is capped at, MaxPageSize.
+	PageSize int
+	// Since is an RFC3339 timestamp or a transaction ID to start from.
+	Since string
+	// Before is an RFC3339 timestamp to end at. Iteration stops at the
+	// first transaction created at or after it.
+	Before string
+	// ExpandMerchant expands the merchant of each transaction inline, so
+	// Transaction.ExpandedMerchant can be used.
+	ExpandMerchant bool
+}
+
+// Transactions returns an iterator over all transactions for an account,
+// oldest first, fetching pages from the API as needed. Each page starts
+// after the last transaction of the previous one.
+//
+// Iteration stops early if the context is cancelled or a request fails;
+// the error is yielded as the final element. opts may be nil.
+//
+//	for tx, err := range client.Transactions(ctx, accountID, nil) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(tx.Description)
+//	}
+func (c *Client) Transactions(ctx context.Context, accountID string, opts *TransactionsOptions) iter.Seq2[Transaction, error] {
+	var o TransactionsOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.PageSize <= 0 || o.PageSize > MaxPageSize {
+		o.PageSize = MaxPageSize
+	}
+
+	var before time.Time
+	if o.Before != "" {
+		// A malformed Before is left for the API to reject.
+		before, _ = time.Parse(time.RFC3339, o.Before)
+	}
+
+	return func(yield func(Transaction, error) bool) {
+		page := PaginationOptions{
+			Limit:  o.PageSize,
+			Since:  o.Since,
+			Before: o.Before,
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(Transaction{}, err)
+				return
+			}
+
+			txs, err := c.listTransactions(ctx, accountID, &page, o.ExpandMerchant)
+			if err != nil {
+				yield(Transaction{}, err)
+				return
+			}
+
+			for _, tx := range txs {
+				if !before.IsZero() && !tx.Created.Before(before) {
+					return
+				}
+				if !yield(tx, nil) {
+					return
+				}
+			}
+
+			// A short page means there is nothing left to fetch.
+			if len(txs) < page.Limit {
+				return
+			}
+			page.Since = txs[len(txs)-1].ID
+		}
+	}
+}
+
+// All collects every element of seq into a slice, stopping at the first
+// error. The elements collected before the error are returned with it.
+//
+//	txs, err := monzo.All(client.Transactions(ctx, accountID, nil))
+func All[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	var out []T
+	for v, err := range seq {
+		if err != nil {
+			return out, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
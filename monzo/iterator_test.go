@@ -0,0 +1,171 @@
+package monzo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// serveTransactions registers a /transactions handler that pages through n
+// transactions, one per hour from 2025-01-01, honouring limit and since
+// (as a transaction ID). It returns a pointer to the number of requests.
+func serveTransactions(t *testing.T, mux *http.ServeMux, n int) *int {
+	t.Helper()
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	all := make([]map[string]interface{}, n)
+	for i := range all {
+		all[i] = map[string]interface{}{
+			"id":      fmt.Sprintf("tx_%03d", i),
+			"amount":  -100,
+			"created": start.Add(time.Duration(i) * time.Hour).Format(time.RFC3339),
+		}
+	}
+
+	requests := 0
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		from := 0
+		if since := query.Get("since"); since != "" {
+			for i, tx := range all {
+				if tx["id"] == since {
+					from = i + 1
+				}
+			}
+		}
+		to := min(from+limit, len(all))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"transactions": all[from:to]})
+	})
+	return &requests
+}
+
+func TestTransactions_WalksAllPages(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+	requests := serveTransactions(t, mux, 250)
+
+	txs, err := All(client.Transactions(context.Background(), "acc_001", nil))
+	if err != nil {
+		t.Fatalf("Transactions returned an error: %v", err)
+	}
+	if len(txs) != 250 {
+		t.Fatalf("expected 250 transactions, got %d", len(txs))
+	}
+	if txs[0].ID != "tx_000" || txs[249].ID != "tx_249" {
+		t.Errorf("unexpected first/last IDs: %s, %s", txs[0].ID, txs[249].ID)
+	}
+	if *requests != 3 {
+		t.Errorf("expected 3 requests, got %d", *requests)
+	}
+}
+
+func TestTransactions_ExactMultipleOfPageSize(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+	requests := serveTransactions(t, mux, 20)
+
+	txs, err := All(client.Transactions(context.Background(), "acc_001", &TransactionsOptions{PageSize: 10}))
+	if err != nil {
+		t.Fatalf("Transactions returned an error: %v", err)
+	}
+	if len(txs) != 20 {
+		t.Errorf("expected 20 transactions, got %d", len(txs))
+	}
+	// Two full pages, then an empty one to confirm there's nothing left.
+	if *requests != 3 {
+		t.Errorf("expected 3 requests, got %d", *requests)
+	}
+}
+
+func TestTransactions_StopsAtBefore(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+	serveTransactions(t, mux, 50)
+
+	opts := &TransactionsOptions{PageSize: 10, Before: "2025-01-01T05:00:00Z"}
+	txs, err := All(client.Transactions(context.Background(), "acc_001", opts))
+	if err != nil {
+		t.Fatalf("Transactions returned an error: %v", err)
+	}
+	if len(txs) != 5 {
+		t.Errorf("expected 5 transactions before 05:00, got %d", len(txs))
+	}
+}
+
+func TestTransactions_EarlyBreak(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+	requests := serveTransactions(t, mux, 250)
+
+	count := 0
+	for _, err := range client.Transactions(context.Background(), "acc_001", nil) {
+		if err != nil {
+			t.Fatalf("Transactions returned an error: %v", err)
+		}
+		count++
+		if count == 5 {
+			break
+		}
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestTransactions_ContextCancelled(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+	serveTransactions(t, mux, 250)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	var gotErr error
+	for _, err := range client.Transactions(ctx, "acc_001", nil) {
+		if err != nil {
+			gotErr = err
+			break
+		}
+		count++
+		if count == 100 {
+			cancel()
+		}
+	}
+	if !errors.Is(gotErr, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", gotErr)
+	}
+	if count != 100 {
+		t.Errorf("expected 100 transactions before cancellation, got %d", count)
+	}
+}
+
+func TestTransactions_ExpandMerchant(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("expand[]"); got != "merchant" {
+			t.Errorf("expected expand[] 'merchant', got %q", got)
+		}
+		fmt.Fprint(w, `{"transactions": [{"id": "tx_001", "merchant": {"id": "merch_001", "name": "Coffee Shop"}}]}`)
+	})
+
+	txs, err := All(client.Transactions(context.Background(), "acc_001", &TransactionsOptions{ExpandMerchant: true}))
+	if err != nil {
+		t.Fatalf("Transactions returned an error: %v", err)
+	}
+	m, ok := txs[0].ExpandedMerchant()
+	if !ok || m.Name != "Coffee Shop" {
+		t.Errorf("expected expanded merchant 'Coffee Shop', got %v", m)
+	}
+}
@@ -0,0 +1,134 @@
+package monzo
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Call describes a single logical API call, as seen by middleware.
+// A call may be sent more than once if it is retried; middleware wraps the
+// call as a whole, so it sees each call exactly once along with its final
+// error.
+type Call struct {
+	// Operation is the name of the client method that made the call,
+	// e.g. "ListTransactions".
+	Operation string
+	// Method is the HTTP method, e.g. "GET".
+	Method string
+	// Path is the API path, e.g. "/transactions".
+	Path string
+	// Query holds the query parameters. It may be nil.
+	Query url.Values
+	// Header holds extra headers to send with the request. Middleware may
+	// add to it before calling the next handler.
+	Header http.Header
+	// Body is the request body: url.Values for form-encoded requests,
+	// any other value for JSON requests, or nil.
+	Body interface{}
+	// Result is the value the response is decoded into. It is populated
+	// once the next handler returns without error. It may be nil.
+	Result interface{}
+}
+
+// CallHandler performs an API call. The error it returns is the decoded
+// error for the call, typically an *APIError for failed responses.
+type CallHandler func(ctx context.Context, call *Call) error
+
+// Middleware wraps a CallHandler to add behaviour around every API call,
+// such as logging, metrics or header injection. A middleware must call
+// next to continue the call, or return an error to short-circuit it.
+type Middleware func(next CallHandler) CallHandler
+
+// WithMiddleware adds middleware to the client. Middleware runs in the
+// order it is given: the first middleware is the outermost, seeing the
+// call first and its error last. Calling WithMiddleware more than once
+// appends to the chain.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// chain wraps h in the given middleware, so that middleware[0] runs first.
+func chain(h CallHandler, middleware []Middleware) CallHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// LoggingMiddleware logs every call with its operation name, duration and
+// outcome. Successful calls are logged at info level and failed ones at
+// error level.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next CallHandler) CallHandler {
+		return func(ctx context.Context, call *Call) error {
+			start := time.Now()
+			err := next(ctx, call)
+			attrs := []any{
+				"operation", call.Operation,
+				"method", call.Method,
+				"path", call.Path,
+				"duration", time.Since(start),
+			}
+			if err != nil {
+				logger.ErrorContext(ctx, "monzo: call failed", append(attrs, "error", err)...)
+			} else {
+				logger.InfoContext(ctx, "monzo: call succeeded", attrs...)
+			}
+			return err
+		}
+	}
+}
+
+// HeaderMiddleware adds the given headers to every request.
+func HeaderMiddleware(header http.Header) Middleware {
+	return func(next CallHandler) CallHandler {
+		return func(ctx context.Context, call *Call) error {
+			for key, values := range header {
+				for _, v := range values {
+					call.Header.Add(key, v)
+				}
+			}
+			return next(ctx, call)
+		}
+	}
+}
+
+// ObserverMiddleware calls observe after every call with its duration and
+// error. It is a convenient hook for recording metrics or an audit trail.
+func ObserverMiddleware(observe func(ctx context.Context, call *Call, duration time.Duration, err error)) Middleware {
+	return func(next CallHandler) CallHandler {
+		return func(ctx context.Context, call *Call) error {
+			start := time.Now()
+			err := next(ctx, call)
+			observe(ctx, call, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// ChaosMiddleware fails a random fraction of calls with fault, without
+// sending them, to exercise error handling in tests. rate is between 0
+// (never fail) and 1 (always fail). If fault is nil, an *APIError with
+// status 503 is returned.
+func ChaosMiddleware(rate float64, fault error) Middleware {
+	return func(next CallHandler) CallHandler {
+		return func(ctx context.Context, call *Call) error {
+			if rand.Float64() < rate {
+				if fault != nil {
+					return fault
+				}
+				return &APIError{
+					StatusCode: http.StatusServiceUnavailable,
+					Body:       "injected by ChaosMiddleware",
+				}
+			}
+			return next(ctx, call)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_Order(t *testing.T) {
+	var order []string
+	record := func(name string) Middleware {
+		return func(next CallHandler) CallHandler {
+			return func(ctx context.Context, call *Call) error {
+				order = append(order, name+" before")
+				err := next(ctx, call)
+				order = append(order, name+" after")
+				return err
+			}
+		}
+	}
+
+	client, mux, teardown := setup(t, WithMiddleware(record("first"), record("second")))
+	defer teardown()
+
+	mux.HandleFunc("/ping/whoami", func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "request")
+		fmt.Fprint(w, `{"authenticated": true}`)
+	})
+
+	if _, err := client.WhoAmI(context.Background()); err != nil {
+		t.Fatalf("WhoAmI returned an error: %v", err)
+	}
+
+	want := []string{"first before", "second before", "request", "second after", "first after"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("expected order %v, got %v", want, order)
+	}
+}
+
+func TestMiddleware_SeesCall(t *testing.T) {
+	var seen Call
+	var seenErr error
+
+	client, mux, teardown := setup(t, WithMiddleware(
+		ObserverMiddleware(func(ctx context.Context, call *Call, d time.Duration, err error) {
+			seen = *call
+			seenErr = err
+		}),
+	))
+	defer teardown()
+
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code": "not_found", "message": "Account not found"}`)
+	})
+
+	_, err := client.ListTransactions(context.Background(), "acc_001", &PaginationOptions{Limit: 10})
+	if err == nil {
+		t.Fatal("expected an error, but got nil")
+	}
+
+	if seen.Operation != "ListTransactions" {
+		t.Errorf("expected operation 'ListTransactions', got %s", seen.Operation)
+	}
+	if seen.Method != http.MethodGet || seen.Path != "/transactions" {
+		t.Errorf("expected GET /transactions, got %s %s", seen.Method, seen.Path)
+	}
+	if seen.Query.Get("limit") != "10" {
+		t.Errorf("expected limit query '10', got %s", seen.Query.Get("limit"))
+	}
+	if !errors.Is(seenErr, ErrNotFound) {
+		t.Errorf("expected middleware to see a decoded not found error, got %v", seenErr)
+	}
+}
+
+func TestHeaderMiddleware(t *testing.T) {
+	client, mux, teardown := setup(t, WithMiddleware(
+		HeaderMiddleware(http.Header{"X-Trace-Id": {"trace-123"}}),
+	))
+	defer teardown()
+
+	mux.HandleFunc("/pots", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Trace-Id"); got != "trace-123" {
+			t.Errorf("expected X-Trace-Id 'trace-123', got %q", got)
+		}
+		fmt.Fprint(w, `{"pots": []}`)
+	})
+
+	if _, err := client.ListPots(context.Background(), "acc_001"); err != nil {
+		t.Fatalf("ListPots returned an error: %v", err)
+	}
+}
+
+func TestChaosMiddleware(t *testing.T) {
+	fault := errors.New("injected")
+	client, mux, teardown := setup(t, WithMiddleware(ChaosMiddleware(1, fault)))
+	defer teardown()
+
+	mux.HandleFunc("/ping/whoami", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the request to be short-circuited")
+	})
+
+	if _, err := client.WhoAmI(context.Background()); !errors.Is(err, fault) {
+		t.Errorf("expected injected fault, got %v", err)
+	}
+}
+
+func TestMiddleware_ShortCircuitWithResult(t *testing.T) {
+	// Middleware can satisfy a call itself, e.g. from a cache.
+	cached := func(next CallHandler) CallHandler {
+		return func(ctx context.Context, call *Call) error {
+			if resp, ok := call.Result.(*Balance); ok && call.Query.Get("account_id") == "acc_cached" {
+				*resp = Balance{Balance: 42, Currency: "GBP"}
+				return nil
+			}
+			return next(ctx, call)
+		}
+	}
+
+	client := NewClient(nil, WithBaseURL("http://127.0.0.1:0"), WithMiddleware(cached))
+	balance, err := client.GetBalance(context.Background(), "acc_cached")
+	if err != nil {
+		t.Fatalf("GetBalance returned an error: %v", err)
+	}
+	if balance.Balance != 42 {
+		t.Errorf("expected balance 42, got %d", balance.Balance)
+	}
+}
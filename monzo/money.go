@@ -0,0 +1,345 @@
+package monzo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrCurrencyMismatch is returned when adding or subtracting Money in
+	// different currencies.
+	ErrCurrencyMismatch = errors.New("monzo: currency mismatch")
+	// ErrAmountOverflow is returned when Money arithmetic overflows int64.
+	ErrAmountOverflow = errors.New("monzo: amount overflow")
+)
+
+// Money is an amount of money in minor units (e.g. pennies) of an ISO 4217
+// currency. Use it instead of dividing amounts by 100, which is wrong for
+// currencies such as JPY that have no minor unit.
+type Money struct {
+	// Amount is the amount in minor units. Negative for debits.
+	Amount int64
+	// Currency is the ISO 4217 currency code (e.g., "GBP").
+	Currency string
+}
+
+// NewMoney returns Money for amount minor units of currency.
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// currencyExponents lists ISO 4217 currencies whose minor unit isn't a
+// hundredth of the major unit. All other currencies have an exponent of 2.
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// currencySymbols maps currency codes to their symbols, for formatting and
+// parsing. Currencies without an entry are shown with their code.
+var currencySymbols = map[string]string{
+	"GBP": "£",
+	"EUR": "€",
+	"USD": "$",
+	"JPY": "¥",
+	"INR": "₹",
+	"KRW": "₩",
+}
+
+// CurrencyExponent returns the number of decimal places in the minor unit
+// of an ISO 4217 currency, e.g. 2 for GBP and 0 for JPY.
+func CurrencyExponent(currency string) int {
+	if exp, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Neg returns the amount with its sign flipped.
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Add returns m + other. It fails with ErrCurrencyMismatch if the
+// currencies differ, and ErrAmountOverflow if the result doesn't fit.
+func (m Money) Add(other Money) (Money, error) {
+	if !strings.EqualFold(m.Currency, other.Currency) {
+		return Money{}, fmt.Errorf("%w: cannot add %s to %s", ErrCurrencyMismatch, other.Currency, m.Currency)
+	}
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other. It fails with ErrCurrencyMismatch if the
+// currencies differ, and ErrAmountOverflow if the result doesn't fit.
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrAmountOverflow
+	}
+	if !strings.EqualFold(m.Currency, other.Currency) {
+		return Money{}, fmt.Errorf("%w: cannot subtract %s from %s", ErrCurrencyMismatch, other.Currency, m.Currency)
+	}
+	return m.Add(other.Neg())
+}
+
+// Major returns the amount in major units, e.g. 12.34 for 1234 pennies.
+// It is intended for display and charting only: use Amount for anything
+// that must add up exactly.
+func (m Money) Major() float64 {
+	return float64(m.Amount) / math.Pow10(CurrencyExponent(m.Currency))
+}
+
+// Locale describes how amounts of money are written in a region.
+type Locale struct {
+	// DecimalSeparator separates major and minor units.
+	DecimalSeparator string
+	// GroupSeparator separates groups of thousands.
+	GroupSeparator string
+	// SymbolAfter places the currency symbol after the amount, separated
+	// by a no-break space.
+	SymbolAfter bool
+}
+
+var (
+	// LocaleGB formats money as in the UK, e.g. "£1,234.56". The US
+	// writes money the same way.
+	LocaleGB = Locale{DecimalSeparator: ".", GroupSeparator: ","}
+	// LocaleDE formats money as in Germany, e.g. "1.234,56 €".
+	LocaleDE = Locale{DecimalSeparator: ",", GroupSeparator: ".", SymbolAfter: true}
+	// LocaleFR formats money as in France, e.g. "1 234,56 €", grouping
+	// with a narrow no-break space.
+	LocaleFR = Locale{DecimalSeparator: ",", GroupSeparator: "\u202f", SymbolAfter: true}
+)
+
+// String formats the amount using LocaleGB, e.g. "£12.34" or "-¥500".
+func (m Money) String() string {
+	return m.Format(LocaleGB)
+}
+
+// Format formats the amount with its currency symbol according to loc.
+// Currencies without a known symbol are written with their code, e.g.
+// "CHF 12.50".
+func (m Money) Format(loc Locale) string {
+	exp := CurrencyExponent(m.Currency)
+
+	// Work with the magnitude as a uint64, so MinInt64 doesn't overflow.
+	neg := m.Amount < 0
+	abs := uint64(m.Amount)
+	if neg {
+		abs = -abs
+	}
+	digits := strconv.FormatUint(abs, 10)
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	major, minor := digits[:len(digits)-exp], digits[len(digits)-exp:]
+
+	var b strings.Builder
+	for i, r := range major {
+		if i > 0 && (len(major)-i)%3 == 0 {
+			b.WriteString(loc.GroupSeparator)
+		}
+		b.WriteRune(r)
+	}
+	if exp > 0 {
+		b.WriteString(loc.DecimalSeparator)
+		b.WriteString(minor)
+	}
+	number := b.String()
+
+	sign := ""
+	if neg {
+		sign = "-"
+	}
+	symbol, ok := currencySymbols[strings.ToUpper(m.Currency)]
+	switch {
+	case loc.SymbolAfter:
+		if !ok {
+			symbol = strings.ToUpper(m.Currency)
+		}
+		return sign + number + "\u00a0" + symbol
+	case ok:
+		return sign + symbol + number
+	default:
+		return sign + strings.ToUpper(m.Currency) + " " + number
+	}
+}
+
+// ParseMoney parses an amount written with a currency symbol or code,
+// such as "£12.34", "-$5", "¥1,200", "12.34 GBP" or "EUR 9.99". Thousands
+// may be grouped with commas, which must then separate every group of
+// three digits, and "." is the decimal separator. The number of decimal
+// places must not exceed the currency's exponent.
+func ParseMoney(s string) (Money, error) {
+	in := strings.TrimSpace(s)
+
+	neg := false
+	if rest, ok := strings.CutPrefix(in, "-"); ok {
+		neg = true
+		in = strings.TrimSpace(rest)
+	}
+
+	currency := ""
+	for code, symbol := range currencySymbols {
+		if rest, ok := strings.CutPrefix(in, symbol); ok {
+			currency, in = code, rest
+			break
+		}
+	}
+	if currency == "" {
+		fields := strings.Fields(in)
+		switch {
+		case len(fields) == 2 && isCurrencyCode(fields[0]):
+			currency, in = strings.ToUpper(fields[0]), fields[1]
+		case len(fields) == 2 && isCurrencyCode(fields[1]):
+			currency, in = strings.ToUpper(fields[1]), fields[0]
+		default:
+			return Money{}, fmt.Errorf("monzo: cannot parse money %q: no currency", s)
+		}
+	}
+	in = strings.TrimSpace(in)
+	if !neg {
+		if rest, ok := strings.CutPrefix(in, "-"); ok {
+			neg = true
+			in = rest
+		}
+	}
+
+	major, minor, _ := strings.Cut(in, ".")
+	major, grouped := ungroupDigits(major)
+	exp := CurrencyExponent(currency)
+	if !grouped || major == "" || len(minor) > exp || !isDigits(major) || !isDigits(minor) {
+		return Money{}, fmt.Errorf("monzo: cannot parse money %q", s)
+	}
+	minor += strings.Repeat("0", exp-len(minor))
+
+	amount, err := strconv.ParseInt(major+minor, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("monzo: cannot parse money %q: %w", s, err)
+	}
+	if neg {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// isCurrencyCode reports whether s looks like an ISO 4217 code.
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ungroupDigits removes the commas from a number grouped in thousands,
+// such as "1,234,567". It reports false if commas are used but don't
+// separate groups of three digits, as in "1,2,3".
+func ungroupDigits(s string) (string, bool) {
+	if !strings.Contains(s, ",") {
+		return s, true
+	}
+	groups := strings.Split(s, ",")
+	if len(groups[0]) < 1 || len(groups[0]) > 3 {
+		return "", false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return "", false
+		}
+	}
+	return strings.Join(groups, ""), true
+}
+
+// isDigits reports whether s consists only of ASCII digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// --- Money accessors ---
+
+// BalanceMoney returns the available balance as Money.
+func (b *Balance) BalanceMoney() Money {
+	return NewMoney(b.Balance, b.Currency)
+}
+
+// TotalBalanceMoney returns the balance including all pots as Money.
+func (b *Balance) TotalBalanceMoney() Money {
+	return NewMoney(b.TotalBalance, b.Currency)
+}
+
+// SpendTodayMoney returns the amount spent today as Money.
+func (b *Balance) SpendTodayMoney() Money {
+	return NewMoney(b.SpendToday, b.Currency)
+}
+
+// BalanceMoney returns the pot's balance as Money.
+func (p *Pot) BalanceMoney() Money {
+	return NewMoney(p.Balance, p.Currency)
+}
+
+// GoalMoney returns the pot's savings goal as Money.
+func (p *Pot) GoalMoney() Money {
+	return NewMoney(p.GoalAmount, p.Currency)
+}
+
+// GoalRemainingMoney returns how much more must be saved to reach the
+// pot's goal as Money.
+func (p *Pot) GoalRemainingMoney() Money {
+	return NewMoney(p.GoalRemaining(), p.Currency)
+}
+
+// AmountMoney returns the transaction amount as Money.
+func (t *Transaction) AmountMoney() Money {
+	return NewMoney(t.Amount, t.Currency)
+}
+
+// LocalAmountMoney returns the amount in the currency the transaction was
+// made in as Money.
+func (t *Transaction) LocalAmountMoney() Money {
+	return NewMoney(t.LocalAmount, t.LocalCurrency)
+}
+
+// TotalMoney returns the receipt total as Money.
+func (r *Receipt) TotalMoney() Money {
+	return NewMoney(r.Total, r.Currency)
+}
+
+// AmountMoney returns the item's amount as Money.
+func (i *ReceiptItem) AmountMoney() Money {
+	return NewMoney(i.Amount, i.Currency)
+}
+
+// AmountMoney returns the tax amount as Money.
+func (t *ReceiptTax) AmountMoney() Money {
+	return NewMoney(t.Amount, t.Currency)
+}
+
+// AmountMoney returns the payment amount as Money.
+func (p *ReceiptPayment) AmountMoney() Money {
+	return NewMoney(p.Amount, p.Currency)
+}
@@ -0,0 +1,119 @@
+package monzo
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoney_Format(t *testing.T) {
+	tests := []struct {
+		money Money
+		loc   Locale
+		want  string
+	}{
+		{NewMoney(1234, "GBP"), LocaleGB, "£12.34"},
+		{NewMoney(-5, "GBP"), LocaleGB, "-£0.05"},
+		{NewMoney(123456789, "USD"), LocaleGB, "$1,234,567.89"},
+		{NewMoney(1200, "JPY"), LocaleGB, "¥1,200"},
+		{NewMoney(1234, "KWD"), LocaleGB, "KWD 1.234"},
+		{NewMoney(1250, "CHF"), LocaleGB, "CHF 12.50"},
+		{NewMoney(123456, "EUR"), LocaleDE, "1.234,56\u00a0€"},
+		{NewMoney(123456, "EUR"), LocaleFR, "1\u202f234,56\u00a0€"},
+		{NewMoney(math.MinInt64, "GBP"), LocaleGB, "-£92,233,720,368,547,758.08"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.Format(tt.loc); got != tt.want {
+			t.Errorf("Format(%+v) = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+
+	if got := NewMoney(1234, "gbp").String(); got != "£12.34" {
+		t.Errorf("String() = %q, want %q", got, "£12.34")
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Money
+	}{
+		{"£12.34", Money{1234, "GBP"}},
+		{"-£5", Money{-500, "GBP"}},
+		{"£-5.5", Money{-550, "GBP"}},
+		{"$1,234.56", Money{123456, "USD"}},
+		{"$1,234,567", Money{123456700, "USD"}},
+		{"¥1,200", Money{1200, "JPY"}},
+		{"12.34 GBP", Money{1234, "GBP"}},
+		{"eur 9.99", Money{999, "EUR"}},
+		{"KWD 1.5", Money{1500, "KWD"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.input)
+		if err != nil {
+			t.Errorf("ParseMoney(%q) returned an error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"12.34", "£12.345", "¥12.5", "£", "£1.2.3", "£abc", "12.34 POUNDS",
+		"£1,2,3.45", "£1234,567", "£,123", "£1,23", "£1,234,", "£1.234,56", "£0.1,2"} {
+		if _, err := ParseMoney(input); err == nil {
+			t.Errorf("ParseMoney(%q) expected an error, got nil", input)
+		}
+	}
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	a := NewMoney(1000, "GBP")
+	b := NewMoney(250, "GBP")
+
+	sum, err := a.Add(b)
+	if err != nil || sum != NewMoney(1250, "GBP") {
+		t.Errorf("Add = %+v, %v; want 1250 GBP", sum, err)
+	}
+	diff, err := a.Sub(b)
+	if err != nil || diff != NewMoney(750, "GBP") {
+		t.Errorf("Sub = %+v, %v; want 750 GBP", diff, err)
+	}
+
+	if _, err := a.Add(NewMoney(100, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch, got %v", err)
+	}
+	if _, err := a.Sub(NewMoney(100, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch, got %v", err)
+	}
+	if _, err := NewMoney(math.MaxInt64, "GBP").Add(NewMoney(1, "GBP")); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("expected ErrAmountOverflow, got %v", err)
+	}
+	if _, err := NewMoney(0, "GBP").Sub(NewMoney(math.MinInt64, "GBP")); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("expected ErrAmountOverflow, got %v", err)
+	}
+}
+
+func TestMoney_Major(t *testing.T) {
+	if got := NewMoney(1234, "GBP").Major(); got != 12.34 {
+		t.Errorf("expected 12.34, got %v", got)
+	}
+	if got := NewMoney(1234, "JPY").Major(); got != 1234 {
+		t.Errorf("expected 1234, got %v", got)
+	}
+}
+
+func TestMoney_Accessors(t *testing.T) {
+	balance := &Balance{Balance: 5000, TotalBalance: 6000, SpendToday: -120, Currency: "GBP"}
+	if got := balance.TotalBalanceMoney().String(); got != "£60.00" {
+		t.Errorf("expected £60.00, got %s", got)
+	}
+
+	tx := &Transaction{Amount: -1734, Currency: "GBP", LocalAmount: -2050, LocalCurrency: "EUR"}
+	if got := tx.LocalAmountMoney(); got != NewMoney(-2050, "EUR") {
+		t.Errorf("expected -2050 EUR, got %+v", got)
+	}
+	if got := tx.AmountMoney().Format(LocaleGB); got != "-£17.34" {
+		t.Errorf("expected -£17.34, got %s", got)
+	}
+}
@@ -13,12 +13,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,103 +38,202 @@ const (
 // Client is the Monzo API client. It manages all interactions with
 // the Monzo API.
 type Client struct {
-	httpClient *http.Client
-	baseURL    string
-}
-
-// APIError represents an error returned from the Monzo API.
-// It includes the HTTP status code and the raw response body.
-type APIError struct {
-	StatusCode int
-	Body       string
-}
-
-// Error implements the error interface for APIError.
-func (e *APIError) Error() string {
-	return fmt.Sprintf("monzo: API error (status %d): %s", e.StatusCode, e.Body)
+	httpClient    *http.Client
+	baseURL       string
+	userAgent     string
+	timeout       time.Duration
+	retry         RetryPolicy
+	logger        *slog.Logger
+	requestHooks  []func(*http.Request)
+	responseHooks []func(*http.Response)
+	middleware    []Middleware
+
+	// maxConcurrency bounds the requests made at once by methods that
+	// fan out, such as GetBalances.
+	maxConcurrency int
+
+	// historyClamp and authenticatedAt are set by WithHistoryClamp.
+	historyClamp    bool
+	authenticatedAt time.Time
+
+	// handler is the middleware chain wrapped around send, built once
+	// by NewClient.
+	handler CallHandler
 }
 
 // NewClient creates a new Monzo API client.
 // The httpClient provided should be an authorized client, typically
 // from the golang.org/x/oauth2 package, as it must handle
 // adding the "Authorization: Bearer <token>" header to requests.
-func NewClient(httpClient *http.Client) *Client {
-	return &Client{
-		httpClient: httpClient,
-		baseURL:    BaseURL,
+// If httpClient is nil, http.DefaultClient is used.
+//
+// The client can be customised with options such as WithBaseURL and
+// WithRetryPolicy.
+func NewClient(httpClient *http.Client, opts ...Option) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	c := &Client{
+		httpClient:     httpClient,
+		baseURL:        BaseURL,
+		retry:          DefaultRetryPolicy,
+		maxConcurrency: defaultMaxConcurrency,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.DiscardHandler)
 	}
+	c.handler = chain(c.send, c.middleware)
+	return c
 }
 
-// SetBaseURL allows overriding the default base URL. This is primarily
-// used for testing purposes to point the client at a mock server.
+// SetBaseURL allows overriding the default base URL.
+//
+// Deprecated: Use WithBaseURL when creating the client instead. SetBaseURL
+// is not safe to call while the client is in use.
 func (c *Client) SetBaseURL(baseURL string) {
 	c.baseURL = baseURL
 }
 
 // doRequest is the central helper for making API requests.
-// It handles context, method, path, query params, body encoding (JSON or form),
-// and response decoding.
-func (c *Client) doRequest(ctx context.Context, method, path string, query url.Values, body, responseData interface{}) error {
+// It describes the call for any middleware, applies the client's default
+// timeout, and hands the call to the middleware chain, which ends in send.
+// op is the logical operation name, e.g. "ListTransactions".
+func (c *Client) doRequest(ctx context.Context, op, method, path string, query url.Values, body, responseData interface{}) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	call := &Call{
+		Operation: op,
+		Method:    method,
+		Path:      path,
+		Query:     query,
+		Header:    make(http.Header),
+		Body:      body,
+		Result:    responseData,
+	}
+	return c.handler(ctx, call)
+}
+
+// send performs a call over HTTP. It handles the full URL, body encoding
+// (JSON or form), retries according to the client's RetryPolicy, and
+// response decoding.
+func (c *Client) send(ctx context.Context, call *Call) error {
+	method, path := call.Method, call.Path
+
 	fullURL, err := url.Parse(c.baseURL)
 	if err != nil {
 		return err // Should not happen with constant BaseURL
 	}
 	fullURL.Path = path
-	if query != nil {
-		fullURL.RawQuery = query.Encode()
+	if call.Query != nil {
+		fullURL.RawQuery = call.Query.Encode()
 	}
 
-	var reqBody io.Reader
+	var bodyBytes []byte
 	var contentType string
 
-	switch b := body.(type) {
+	switch b := call.Body.(type) {
 	case nil:
 		// No body
 	case url.Values:
 		// Form data
-		reqBody = strings.NewReader(b.Encode())
+		bodyBytes = []byte(b.Encode())
 		contentType = "application/x-www-form-urlencoded"
 	default:
 		// JSON data
-		jsonBody, err := json.Marshal(b)
+		bodyBytes, err = json.Marshal(b)
 		if err != nil {
 			return fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonBody)
 		contentType = "application/json"
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, fullURL.String(), reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
+	retryable := c.retry.allows(method)
 
-	req.Header.Set("Accept", "application/json")
-	if contentType != "" {
-		req.Header.Set("Content-Type", contentType)
-	}
+	for attempt := 1; ; attempt++ {
+		// The body is rebuilt on every attempt, as the previous one
+		// has already been consumed.
+		var reqBody io.Reader
+		if bodyBytes != nil {
+			reqBody = bytes.NewReader(bodyBytes)
+		}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
+		req, err := http.NewRequestWithContext(ctx, method, fullURL.String(), reqBody)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return &APIError{
-			StatusCode: resp.StatusCode,
-			Body:       string(respBody),
+		for key, values := range call.Header {
+			req.Header[key] = append([]string(nil), values...)
+		}
+		req.Header.Set("Accept", "application/json")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if c.userAgent != "" {
+			req.Header.Set("User-Agent", c.userAgent)
+		}
+		for _, hook := range c.requestHooks {
+			hook(req)
+		}
+
+		canRetry := retryable && attempt < c.retry.MaxAttempts
+
+		c.logger.DebugContext(ctx, "monzo: sending request", "method", method, "path", path, "attempt", attempt)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if canRetry && ctx.Err() == nil {
+				wait := c.retry.backoff(attempt)
+				c.logger.WarnContext(ctx, "monzo: request failed, retrying", "method", method, "path", path, "attempt", attempt, "wait", wait, "error", err)
+				if sleep(ctx, wait) == nil {
+					continue
+				}
+			}
+			return fmt.Errorf("failed to execute request: %w", err)
+		}
+		for _, hook := range c.responseHooks {
+			hook(resp)
 		}
-	}
 
-	if responseData != nil {
-		if err := json.NewDecoder(resp.Body).Decode(responseData); err != nil {
-			return fmt.Errorf("failed to decode response body: %w", err)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			apiErr := newAPIError(resp.StatusCode, respBody)
+
+			if canRetry && isRetryableStatus(resp.StatusCode) {
+				wait := c.retry.backoff(attempt)
+				if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+					if c.retry.MaxBackoff > 0 && d > c.retry.MaxBackoff {
+						// The API wants us to back off for longer than we're
+						// willing to wait, so surface the error instead.
+						return apiErr
+					}
+					wait = d
+				}
+				c.logger.WarnContext(ctx, "monzo: API error, retrying", "method", method, "path", path, "attempt", attempt, "status", resp.StatusCode, "wait", wait)
+				if sleep(ctx, wait) == nil {
+					continue
+				}
+			}
+			return apiErr
 		}
-	}
 
-	return nil
+		defer resp.Body.Close()
+		if call.Result != nil {
+			if err := json.NewDecoder(resp.Body).Decode(call.Result); err != nil {
+				return fmt.Errorf("failed to decode response body: %w", err)
+			}
+		}
+
+		return nil
+	}
 }
 
 //####################################################################
@@ -156,7 +259,45 @@ type Account struct {
 	// Created is the timestamp when the account was created.
 	Created time.Time `json:"created"`
 	// Type is the type of account, e.g., "uk_retail", "uk_retail_joint".
-	Type string `json:"type,omitempty"`
+	Type AccountType `json:"type,omitempty"`
+	// ProductType is the product the account belongs to, e.g.,
+	// "standard", "flex" or "rewards".
+	ProductType ProductType `json:"product_type,omitempty"`
+	// Closed is true if the account has been closed.
+	Closed bool `json:"closed"`
+	// Owners is the list of users who own the account. Joint accounts
+	// have more than one owner.
+	Owners []AccountOwner `json:"owners,omitempty"`
+	// AccountNumber is the UK account number.
+	AccountNumber string `json:"account_number,omitempty"`
+	// SortCode is the UK sort code.
+	SortCode string `json:"sort_code,omitempty"`
+	// Currency is the ISO 4217 currency code of the account.
+	Currency string `json:"currency,omitempty"`
+	// CountryCode is the ISO 3166 country code of the account (e.g., "GB").
+	CountryCode string `json:"country_code,omitempty"`
+}
+
+// AccountOwner is a user who owns an account.
+type AccountOwner struct {
+	// UserID is the ID of the user.
+	UserID string `json:"user_id"`
+	// PreferredName is the user's full preferred name.
+	PreferredName string `json:"preferred_name"`
+	// PreferredFirstName is the user's preferred first name.
+	PreferredFirstName string `json:"preferred_first_name"`
+}
+
+// ListAccountsOptions filters the accounts returned by ListAccountsWithOptions.
+type ListAccountsOptions struct {
+	// AccountType only returns accounts of this type. Leave empty for
+	// all types.
+	AccountType AccountType
+	// ExcludeClosed leaves out accounts that have been closed.
+	ExcludeClosed bool
+	// ProductTypes only returns accounts with one of these product types.
+	// Leave empty for all product types.
+	ProductTypes []ProductType
 }
 
 // ListAccountsResponse is the wrapper for the ListAccounts endpoint.
@@ -175,6 +316,44 @@ type Balance struct {
 	Currency string `json:"currency"`
 	// SpendToday is the amount spent today in minor units.
 	SpendToday int64 `json:"spend_today"`
+	// BalanceIncludingFlexibleSavings is the balance including flexible
+	// savings pots, in minor units.
+	BalanceIncludingFlexibleSavings int64 `json:"balance_including_flexible_savings"`
+	// LocalCurrency is the ISO 4217 code of the currency the user is
+	// currently spending in abroad. Empty when spending at home.
+	LocalCurrency string `json:"local_currency"`
+	// LocalExchangeRate is the rate from Currency to LocalCurrency.
+	// Zero when spending at home.
+	LocalExchangeRate ExchangeRate `json:"local_exchange_rate"`
+	// LocalSpend breaks down today's spending by local currency.
+	LocalSpend []LocalSpend `json:"local_spend"`
+}
+
+// LocalSpend is the amount spent today in a single foreign currency.
+type LocalSpend struct {
+	// SpendToday is the amount spent today in minor units of Currency.
+	SpendToday int64 `json:"spend_today"`
+	// Currency is the ISO 4217 currency code (e.g., "EUR").
+	Currency string `json:"currency"`
+}
+
+// ExchangeRate is a currency exchange rate. The API sends it as a number,
+// or as an empty string when there is no rate, which decodes to zero.
+type ExchangeRate float64
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *ExchangeRate) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*r = 0
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("monzo: invalid exchange rate %s: %w", data, err)
+	}
+	*r = ExchangeRate(f)
+	return nil
 }
 
 // Pot represents a Monzo pot.
@@ -184,7 +363,7 @@ type Pot struct {
 	// Name is the user-defined name of the pot.
 	Name string `json:"name"`
 	// Style is the visual style of the pot (e.g., "beach_ball").
-	Style string `json:"style"`
+	Style PotStyle `json:"style"`
 	// Balance is the current balance of the pot in minor units.
 	Balance int64 `json:"balance"`
 	// Currency is the ISO 4217 currency code.
@@ -195,6 +374,56 @@ type Pot struct {
 	Updated time.Time `json:"updated"`
 	// Deleted is true if the pot has been deleted.
 	Deleted bool `json:"deleted"`
+	// GoalAmount is the savings goal for the pot in minor units, or zero
+	// if no goal is set.
+	GoalAmount int64 `json:"goal_amount"`
+	// Type is the kind of pot (e.g., "default" or "flexible_savings").
+	Type string `json:"type,omitempty"`
+	// RoundUp is true if card payments are rounded up into this pot.
+	RoundUp bool `json:"round_up"`
+	// Locked is true if withdrawals from the pot are currently blocked.
+	Locked bool `json:"locked"`
+	// LockedUntil is when the pot unlocks. It is not Valid if the pot
+	// isn't locked until a specific date.
+	LockedUntil NullableTime `json:"locked_until"`
+	// AvailableForBills is true if bills can be paid from the pot.
+	AvailableForBills bool `json:"available_for_bills"`
+	// CurrentAccountID is the ID of the account the pot belongs to.
+	CurrentAccountID string `json:"current_account_id,omitempty"`
+	// HasVirtualCards is true if virtual cards spend from the pot.
+	HasVirtualCards bool `json:"has_virtual_cards"`
+}
+
+// HasGoal reports whether the pot has a savings goal.
+func (p *Pot) HasGoal() bool {
+	return p.GoalAmount > 0
+}
+
+// GoalProgress returns how far the pot is towards its goal, as a
+// percentage between 0 and 100. It returns 0 if the pot has no goal.
+func (p *Pot) GoalProgress() float64 {
+	if !p.HasGoal() || p.Balance <= 0 {
+		return 0
+	}
+	if p.Balance >= p.GoalAmount {
+		return 100
+	}
+	return float64(p.Balance) / float64(p.GoalAmount) * 100
+}
+
+// GoalRemaining returns how much more must be saved to reach the goal, in
+// minor units. It returns 0 if the goal is met or the pot has no goal.
+func (p *Pot) GoalRemaining() int64 {
+	if !p.HasGoal() || p.Balance >= p.GoalAmount {
+		return 0
+	}
+	return p.GoalAmount - p.Balance
+}
+
+// ListPotsOptions filters the pots returned by ListPotsWithOptions.
+type ListPotsOptions struct {
+	// ExcludeDeleted leaves out pots that have been deleted.
+	ExcludeDeleted bool
 }
 
 // ListPotsResponse is the wrapper for the ListPots endpoint.
@@ -226,12 +455,70 @@ type Transaction struct {
 	Notes string `json:"notes"`
 	// IsLoad is true if this is a top-up transaction.
 	IsLoad bool `json:"is_load"`
-	// Settled is the timestamp when the transaction settled.
-	Settled time.Time `json:"settled"`
+	// Settled is the timestamp when the transaction settled. It is not
+	// Valid while the transaction is pending.
+	Settled NullableTime `json:"settled"`
 	// Category is the transaction category (e.g., "eating_out").
-	Category string `json:"category"`
+	Category Category `json:"category"`
 	// DeclineReason is the reason for a declined transaction, if any.
 	DeclineReason string `json:"decline_reason,omitempty"`
+	// Updated is the timestamp when the transaction was last updated.
+	Updated NullableTime `json:"updated"`
+	// UserID is the ID of the user who made the transaction.
+	UserID string `json:"user_id,omitempty"`
+	// LocalAmount is the amount in the currency the transaction was made
+	// in, in minor units. It differs from Amount for foreign spend.
+	LocalAmount int64 `json:"local_amount"`
+	// LocalCurrency is the ISO 4217 currency code of LocalAmount.
+	LocalCurrency string `json:"local_currency"`
+	// Counterparty describes the other side of a bank transfer or
+	// payment between Monzo users. For card payments the API sends an
+	// empty object, which decodes to an empty, non-nil Counterparty; it
+	// is only nil if the field is missing. Check its fields, rather than
+	// comparing it with nil, to tell whether there is a counterparty.
+	Counterparty *Counterparty `json:"counterparty,omitempty"`
+	// Attachments is a list of files attached to the transaction.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Categories splits the amount across spending categories, in minor
+	// units. Most transactions have a single entry for Category.
+	Categories map[Category]int64 `json:"categories,omitempty"`
+	// IncludeInSpending is true if the transaction counts towards the
+	// user's spending totals.
+	IncludeInSpending bool `json:"include_in_spending"`
+	// Scheme is the payment scheme used, e.g. "mastercard",
+	// "payport_faster_payments" or "uk_retail_pot".
+	Scheme string `json:"scheme,omitempty"`
+	// DedupeID is the idempotency key the transaction was created with.
+	DedupeID string `json:"dedupe_id,omitempty"`
+	// AmountIsPending is true if the amount may still change, e.g. for a
+	// card authorisation that hasn't been captured.
+	AmountIsPending bool `json:"amount_is_pending"`
+	// Originator is true if the user initiated the transaction.
+	Originator bool `json:"originator"`
+}
+
+// Counterparty is the other party to a transaction, such as the sender of
+// a bank transfer. Which fields are set depends on the payment scheme.
+type Counterparty struct {
+	// Name is the counterparty's name.
+	Name string `json:"name,omitempty"`
+	// PreferredName is the preferred name of a Monzo counterparty.
+	PreferredName string `json:"preferred_name,omitempty"`
+	// SortCode is the counterparty's sort code, for UK bank transfers.
+	SortCode string `json:"sort_code,omitempty"`
+	// AccountNumber is the counterparty's account number, for UK bank
+	// transfers.
+	AccountNumber string `json:"account_number,omitempty"`
+	// AccountID is the counterparty's Monzo account ID, if they bank with
+	// Monzo.
+	AccountID string `json:"account_id,omitempty"`
+	// UserID is the counterparty's Monzo user ID, or an anonymous ID.
+	UserID string `json:"user_id,omitempty"`
+	// BeneficiaryAccountType is the type of the counterparty's account,
+	// e.g. "Personal" or "Business".
+	BeneficiaryAccountType string `json:"beneficiary_account_type,omitempty"`
+	// ServiceUserNumber identifies the originator of a Direct Debit.
+	ServiceUserNumber string `json:"service_user_number,omitempty"`
 }
 
 // MerchantID attempts to unmarshal the Merchant field as a string ID.
@@ -281,7 +568,7 @@ type Merchant struct {
 	// Name is the name of the merchant.
 	Name string `json:"name"`
 	// Category is the default category for the merchant.
-	Category string `json:"category"`
+	Category Category `json:"category"`
 }
 
 // Address represents a physical address.
@@ -396,7 +683,7 @@ type ReceiptTax struct {
 // ReceiptPayment represents payment details on a receipt.
 type ReceiptPayment struct {
 	// Type is the payment type: "card", "cash", or "gift_card".
-	Type string `json:"type"`
+	Type PaymentType `json:"type"`
 	// Amount is the amount paid in minor units.
 	Amount int64 `json:"amount"`
 	// Currency is the ISO 4217 currency code.
@@ -461,12 +748,24 @@ type ListWebhooksResponse struct {
 }
 
 // WebhookEvent represents the outer envelope of an incoming webhook.
-// The Data field contains the specific payload, e.g., a Transaction.
+// The Data field contains the raw payload, which can be decoded with the
+// typed accessors, e.g., Transaction.
 type WebhookEvent struct {
 	// Type is the event type, e.g., "transaction.created".
-	Type string `json:"type"`
-	// Data is the payload of the event.
-	Data Transaction `json:"data"`
+	Type WebhookEventType `json:"type"`
+	// Data is the raw JSON payload of the event.
+	Data json.RawMessage `json:"data"`
+	// Extra holds any fields the event had that this package doesn't know
+	// about, so they aren't lost. Fields of the payload are keyed as
+	// "data.<name>". It is always nil with WithStrictWebhookDecoding.
+	Extra map[string]json.RawMessage `json:"-"`
+
+	// strict is set if the event was parsed with WithStrictWebhookDecoding.
+	strict bool
+	// deduper and dedupeKey hold the claim taken by ParseWebhookEvent
+	// with WithWebhookDeduper, until MarkHandled or Release.
+	deduper   WebhookDeduper
+	dedupeKey string
 }
 
 //####################################################################
@@ -479,7 +778,7 @@ type WebhookEvent struct {
 // This is a good way to test your authentication.
 func (c *Client) WhoAmI(ctx context.Context) (*WhoAmIResponse, error) {
 	var resp WhoAmIResponse
-	err := c.doRequest(ctx, http.MethodGet, "/ping/whoami", nil, nil, &resp)
+	err := c.doRequest(ctx, "WhoAmI", http.MethodGet, "/ping/whoami", nil, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -488,26 +787,53 @@ func (c *Client) WhoAmI(ctx context.Context) (*WhoAmIResponse, error) {
 
 // Logout invalidates the current access token.
 func (c *Client) Logout(ctx context.Context) error {
-	return c.doRequest(ctx, http.MethodPost, "/oauth2/logout", nil, nil, nil)
+	return c.doRequest(ctx, "Logout", http.MethodPost, "/oauth2/logout", nil, nil, nil)
 }
 
 // --- Accounts ---
 
 // ListAccounts returns a list of accounts owned by the user.
-// accountType can be used to filter ("uk_retail", "uk_retail_joint").
+// accountType can be used to filter (e.g., AccountTypeUKRetail).
 // Pass an empty string to list all accounts.
-func (c *Client) ListAccounts(ctx context.Context, accountType string) ([]Account, error) {
+func (c *Client) ListAccounts(ctx context.Context, accountType AccountType) ([]Account, error) {
+	return c.ListAccountsWithOptions(ctx, &ListAccountsOptions{AccountType: accountType})
+}
+
+// ListAccountsWithOptions returns a list of accounts owned by the user,
+// filtered by options. The account type is filtered by the API; closed
+// accounts and product types are filtered by the client.
+// options may be nil to list all accounts.
+func (c *Client) ListAccountsWithOptions(ctx context.Context, options *ListAccountsOptions) ([]Account, error) {
+	var opts ListAccountsOptions
+	if options != nil {
+		opts = *options
+	}
+
 	query := url.Values{}
-	if accountType != "" {
-		query.Set("account_type", accountType)
+	if opts.AccountType != "" {
+		query.Set("account_type", string(opts.AccountType))
 	}
 
 	var resp ListAccountsResponse
-	err := c.doRequest(ctx, http.MethodGet, "/accounts", query, nil, &resp)
+	err := c.doRequest(ctx, "ListAccounts", http.MethodGet, "/accounts", query, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
-	return resp.Accounts, nil
+
+	if !opts.ExcludeClosed && len(opts.ProductTypes) == 0 {
+		return resp.Accounts, nil
+	}
+	accounts := make([]Account, 0, len(resp.Accounts))
+	for _, acc := range resp.Accounts {
+		if opts.ExcludeClosed && acc.Closed {
+			continue
+		}
+		if len(opts.ProductTypes) > 0 && !slices.Contains(opts.ProductTypes, acc.ProductType) {
+			continue
+		}
+		accounts = append(accounts, acc)
+	}
+	return accounts, nil
 }
 
 // --- Balance ---
@@ -518,13 +844,53 @@ func (c *Client) GetBalance(ctx context.Context, accountID string) (*Balance, er
 	query.Set("account_id", accountID)
 
 	var resp Balance
-	err := c.doRequest(ctx, http.MethodGet, "/balance", query, nil, &resp)
+	err := c.doRequest(ctx, "GetBalance", http.MethodGet, "/balance", query, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
+// GetBalances fetches the balances of several accounts concurrently,
+// keyed by account ID. At most the client's max concurrency requests are
+// in flight at once (see WithMaxConcurrency).
+//
+// If some requests fail, the balances that were fetched are returned along
+// with an error joining each failure.
+func (c *Client) GetBalances(ctx context.Context, accountIDs ...string) (map[string]*Balance, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		errs     []error
+		balances = make(map[string]*Balance, len(accountIDs))
+		sem      = make(chan struct{}, c.maxConcurrency)
+	)
+
+	for _, id := range accountIDs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			balance, err := c.GetBalance(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("account %s: %w", id, err))
+				return
+			}
+			balances[id] = balance
+		}()
+	}
+	wg.Wait()
+
+	return balances, errors.Join(errs...)
+}
+
 // --- Pots ---
 
 // ListPots returns a list of pots for a specific account.
@@ -533,13 +899,65 @@ func (c *Client) ListPots(ctx context.Context, accountID string) ([]Pot, error)
 	query.Set("current_account_id", accountID)
 
 	var resp ListPotsResponse
-	err := c.doRequest(ctx, http.MethodGet, "/pots", query, nil, &resp)
+	err := c.doRequest(ctx, "ListPots", http.MethodGet, "/pots", query, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Pots, nil
 }
 
+// ListPotsWithOptions returns a list of pots for a specific account,
+// filtered by options. options may be nil to list all pots.
+func (c *Client) ListPotsWithOptions(ctx context.Context, accountID string, options *ListPotsOptions) ([]Pot, error) {
+	pots, err := c.ListPots(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil || !options.ExcludeDeleted {
+		return pots, nil
+	}
+	return slices.DeleteFunc(pots, func(p Pot) bool { return p.Deleted }), nil
+}
+
+// GetPot finds a pot by its ID or, failing that, by its name. Names are
+// matched case-insensitively, and only against pots that haven't been
+// deleted. The pots of every open account are searched, as the API has no
+// endpoint for fetching a single pot.
+//
+// It returns an error matching ErrNotFound if no pot matches, and an error
+// if a name matches more than one pot.
+func (c *Client) GetPot(ctx context.Context, potIDOrName string) (*Pot, error) {
+	accounts, err := c.ListAccountsWithOptions(ctx, &ListAccountsOptions{ExcludeClosed: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var byName []Pot
+	for _, acc := range accounts {
+		pots, err := c.ListPots(ctx, acc.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, pot := range pots {
+			if pot.ID == potIDOrName {
+				return &pot, nil
+			}
+			if !pot.Deleted && strings.EqualFold(pot.Name, potIDOrName) {
+				byName = append(byName, pot)
+			}
+		}
+	}
+
+	switch len(byName) {
+	case 0:
+		return nil, fmt.Errorf("monzo: pot %q: %w", potIDOrName, ErrNotFound)
+	case 1:
+		return &byName[0], nil
+	default:
+		return nil, fmt.Errorf("monzo: pot name %q is ambiguous: %d pots match", potIDOrName, len(byName))
+	}
+}
+
 // DepositToPot moves money from an account into a pot.
 // amount is in minor units (e.g., pennies).
 // dedupeID is a unique string to prevent duplicate deposits.
@@ -552,7 +970,7 @@ func (c *Client) DepositToPot(ctx context.Context, potID, sourceAccountID, dedup
 	}
 
 	var resp Pot
-	err := c.doRequest(ctx, http.MethodPut, path, nil, form, &resp)
+	err := c.doRequest(ctx, "DepositToPot", http.MethodPut, path, nil, form, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -571,7 +989,7 @@ func (c *Client) WithdrawFromPot(ctx context.Context, potID, destinationAccountI
 	}
 
 	var resp Pot
-	err := c.doRequest(ctx, http.MethodPut, path, nil, form, &resp)
+	err := c.doRequest(ctx, "WithdrawFromPot", http.MethodPut, path, nil, form, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -590,7 +1008,7 @@ func (c *Client) GetTransaction(ctx context.Context, transactionID string, expan
 	}
 
 	var resp GetTransactionResponse
-	err := c.doRequest(ctx, http.MethodGet, path, query, nil, &resp)
+	err := c.doRequest(ctx, "GetTransaction", http.MethodGet, path, query, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -599,9 +1017,24 @@ func (c *Client) GetTransaction(ctx context.Context, transactionID string, expan
 
 // ListTransactions retrieves a list of transactions for an account.
 // Pagination can be controlled using the options parameter.
+// To walk every page, use Transactions instead.
+//
+// Once a token is older than FullHistoryWindow, asking for transactions
+// from before the HistoryWindow fails with ErrHistoryWindowExpired.
 func (c *Client) ListTransactions(ctx context.Context, accountID string, options *PaginationOptions) ([]Transaction, error) {
+	return c.listTransactions(ctx, accountID, options, false)
+}
+
+// listTransactions fetches a single page of transactions, optionally
+// expanding merchants inline.
+func (c *Client) listTransactions(ctx context.Context, accountID string, options *PaginationOptions, expandMerchant bool) ([]Transaction, error) {
+	options = c.clampSince(options)
+
 	query := url.Values{}
 	query.Set("account_id", accountID)
+	if expandMerchant {
+		query.Set("expand[]", "merchant")
+	}
 
 	if options != nil {
 		if options.Limit > 0 {
@@ -616,9 +1049,9 @@ func (c *Client) ListTransactions(ctx context.Context, accountID string, options
 	}
 
 	var resp ListTransactionsResponse
-	err := c.doRequest(ctx, http.MethodGet, "/transactions", query, nil, &resp)
+	err := c.doRequest(ctx, "ListTransactions", http.MethodGet, "/transactions", query, nil, &resp)
 	if err != nil {
-		return nil, err
+		return nil, historyError(err, options)
 	}
 	return resp.Transactions, nil
 }
@@ -634,7 +1067,7 @@ func (c *Client) AnnotateTransaction(ctx context.Context, transactionID string,
 	}
 
 	var resp GetTransactionResponse
-	err := c.doRequest(ctx, http.MethodPatch, path, nil, form, &resp)
+	err := c.doRequest(ctx, "AnnotateTransaction", http.MethodPatch, path, nil, form, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -660,7 +1093,7 @@ func (c *Client) CreateFeedItem(ctx context.Context, accountID, itemType, itemUR
 	}
 
 	// This endpoint returns an empty JSON object {}
-	return c.doRequest(ctx, http.MethodPost, "/feed", nil, form, &struct{}{})
+	return c.doRequest(ctx, "CreateFeedItem", http.MethodPost, "/feed", nil, form, &struct{}{})
 }
 
 // --- Attachments ---
@@ -677,7 +1110,7 @@ func (c *Client) UploadAttachment(ctx context.Context, fileName, fileType string
 	}
 
 	var resp UploadAttachmentResponse
-	err := c.doRequest(ctx, http.MethodPost, "/attachment/upload", nil, form, &resp)
+	err := c.doRequest(ctx, "UploadAttachment", http.MethodPost, "/attachment/upload", nil, form, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -697,7 +1130,7 @@ func (c *Client) RegisterAttachment(ctx context.Context, externalID, fileURL, fi
 	}
 
 	var resp RegisterAttachmentResponse
-	err := c.doRequest(ctx, http.MethodPost, "/attachment/register", nil, form, &resp)
+	err := c.doRequest(ctx, "RegisterAttachment", http.MethodPost, "/attachment/register", nil, form, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -710,7 +1143,7 @@ func (c *Client) DeregisterAttachment(ctx context.Context, attachmentID string)
 		"id": {attachmentID},
 	}
 	// Returns an empty JSON object {}
-	return c.doRequest(ctx, http.MethodPost, "/attachment/deregister", nil, form, &struct{}{})
+	return c.doRequest(ctx, "DeregisterAttachment", http.MethodPost, "/attachment/deregister", nil, form, &struct{}{})
 }
 
 // --- Receipts ---
@@ -720,7 +1153,7 @@ func (c *Client) DeregisterAttachment(ctx context.Context, attachmentID string)
 // This endpoint uses a JSON request body.
 func (c *Client) CreateReceipt(ctx context.Context, receipt *Receipt) (*Receipt, error) {
 	var resp Receipt
-	err := c.doRequest(ctx, http.MethodPut, "/transaction-receipts", nil, receipt, &resp)
+	err := c.doRequest(ctx, "CreateReceipt", http.MethodPut, "/transaction-receipts", nil, receipt, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -733,7 +1166,7 @@ func (c *Client) GetReceipt(ctx context.Context, externalID string) (*Receipt, e
 	query.Set("external_id", externalID)
 
 	var resp GetReceiptResponse
-	err := c.doRequest(ctx, http.MethodGet, "/transaction-receipts", query, nil, &resp)
+	err := c.doRequest(ctx, "GetReceipt", http.MethodGet, "/transaction-receipts", query, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -745,7 +1178,7 @@ func (c *Client) DeleteReceipt(ctx context.Context, externalID string) error {
 	query := url.Values{}
 	query.Set("external_id", externalID)
 	// Returns an empty JSON object {}
-	return c.doRequest(ctx, http.MethodDelete, "/transaction-receipts", query, nil, &struct{}{})
+	return c.doRequest(ctx, "DeleteReceipt", http.MethodDelete, "/transaction-receipts", query, nil, &struct{}{})
 }
 
 // --- Webhooks ---
@@ -758,7 +1191,7 @@ func (c *Client) RegisterWebhook(ctx context.Context, accountID, webhookURL stri
 	}
 
 	var resp RegisterWebhookResponse
-	err := c.doRequest(ctx, http.MethodPost, "/webhooks", nil, form, &resp)
+	err := c.doRequest(ctx, "RegisterWebhook", http.MethodPost, "/webhooks", nil, form, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -771,7 +1204,7 @@ func (c *Client) ListWebhooks(ctx context.Context, accountID string) ([]Webhook,
 	query.Set("account_id", accountID)
 
 	var resp ListWebhooksResponse
-	err := c.doRequest(ctx, http.MethodGet, "/webhooks", query, nil, &resp)
+	err := c.doRequest(ctx, "ListWebhooks", http.MethodGet, "/webhooks", query, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -782,7 +1215,7 @@ func (c *Client) ListWebhooks(ctx context.Context, accountID string) ([]Webhook,
 func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
 	path := fmt.Sprintf("/webhooks/%s", webhookID)
 	// Returns an empty JSON object {}
-	return c.doRequest(ctx, http.MethodDelete, path, nil, nil, &struct{}{})
+	return c.doRequest(ctx, "DeleteWebhook", http.MethodDelete, path, nil, nil, &struct{}{})
 }
 
 // ParseWebhookTransactionCreated parses a 'transaction.created' webhook
@@ -792,29 +1225,24 @@ func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
 // read, is invalid JSON, or is not a 'transaction.created' event.
 // It is recommended to respond with a 200 OK to Monzo even if you
 // encounter an error, to prevent retries.
-func ParseWebhookTransactionCreated(r *http.Request) (*Transaction, error) {
-	// Good practice: defer body closing
-	defer r.Body.Close()
-
-	// Good practice: limit the request body size to prevent abuse (e.g., 1MB)
-	const maxBodyBytes = 1_048_576
-	r.Body = http.MaxBytesReader(nil, r.Body, maxBodyBytes)
-
-	var payload WebhookEvent
-
-	// Create a decoder and be strict about the payload
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-
-	err := dec.Decode(&payload)
+//
+// To handle other event types, use ParseWebhookEvent, or WebhookHandler
+// for a ready-made http.Handler. WithWebhookDeduper is an error here, as
+// the claim it takes couldn't be marked; use ParseWebhookEvent with it.
+func ParseWebhookTransactionCreated(r *http.Request, opts ...WebhookOption) (*Transaction, error) {
+	if newWebhookConfig(opts).deduper != nil {
+		r.Body.Close()
+		return nil, errors.New("monzo: ParseWebhookTransactionCreated doesn't support WithWebhookDeduper; use ParseWebhookEvent")
+	}
+	event, err := ParseWebhookEvent(r, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode webhook JSON: %w", err)
+		return nil, err
 	}
 
 	// Validate the event type
-	if payload.Type != "transaction.created" {
-		return nil, fmt.Errorf("invalid webhook type: expected 'transaction.created', got '%s'", payload.Type)
+	if event.Type != WebhookTransactionCreated {
+		return nil, fmt.Errorf("invalid webhook type: expected 'transaction.created', got '%s'", event.Type)
 	}
 
-	return &payload.Data, nil
+	return event.Transaction()
 }
@@ -2,17 +2,21 @@ package monzo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // setup creates a mock server and a client configured to talk to it.
 // It returns the client, the server's router (mux), and a teardown function.
-func setup(t *testing.T) (client *Client, mux *http.ServeMux, teardown func()) {
+// Any extra options are passed through to NewClient.
+func setup(t *testing.T, opts ...Option) (client *Client, mux *http.ServeMux, teardown func()) {
 	t.Helper()
 
 	mux = http.NewServeMux()
@@ -22,8 +26,7 @@ func setup(t *testing.T) (client *Client, mux *http.ServeMux, teardown func()) {
 	httpClient := server.Client()
 
 	// Create our Monzo client
-	client = NewClient(httpClient)
-	client.SetBaseURL(server.URL)
+	client = NewClient(httpClient, append([]Option{WithBaseURL(server.URL)}, opts...)...)
 
 	teardown = func() {
 		server.Close()
@@ -441,3 +444,514 @@ func TestParseWebhookTransactionCreated_Failure(t *testing.T) {
 		}
 	})
 }
+
+func TestGetTransaction_ForeignCardPayment(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	// A settled card payment made abroad, shaped like a real API response.
+	mockResponse := `
+	{
+		"transaction": {
+			"id": "tx_0000AaBbCcDdEeFf001",
+			"created": "2025-03-14T18:22:05.125Z",
+			"description": "CAFE DE FLORE PARIS FRA",
+			"amount": -1734,
+			"fees": {},
+			"currency": "GBP",
+			"merchant": "merch_0000AaBbCcDdEeFf002",
+			"notes": "",
+			"metadata": {"ledger_insertion_id": "entryset_0000AaBbCcDdEeFf003"},
+			"labels": null,
+			"attachments": [
+				{
+					"id": "attach_0000AaBbCcDdEeFf004",
+					"user_id": "user_0000AaBbCcDdEeFf005",
+					"external_id": "tx_0000AaBbCcDdEeFf001",
+					"file_url": "https://example.com/receipt.jpg",
+					"file_type": "image/jpeg",
+					"created": "2025-03-14T18:30:00Z"
+				}
+			],
+			"category": "eating_out",
+			"categories": {"eating_out": -1234, "holidays": -500},
+			"is_load": false,
+			"settled": "2025-03-16T02:11:43.211Z",
+			"local_amount": -2050,
+			"local_currency": "EUR",
+			"updated": "2025-03-16T02:11:43.689Z",
+			"account_id": "acc_0000AaBbCcDdEeFf006",
+			"user_id": "user_0000AaBbCcDdEeFf005",
+			"counterparty": {},
+			"scheme": "mastercard",
+			"dedupe_id": "mastercard-1234567:2025-03-14:MFPRG1234",
+			"originator": false,
+			"include_in_spending": true,
+			"can_be_excluded_from_breakdown": true,
+			"amount_is_pending": false,
+			"decline_reason": ""
+		}
+	}`
+
+	mux.HandleFunc("/transactions/tx_0000AaBbCcDdEeFf001", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, mockResponse)
+	})
+
+	tx, err := client.GetTransaction(context.Background(), "tx_0000AaBbCcDdEeFf001", false)
+	if err != nil {
+		t.Fatalf("GetTransaction returned an error: %v", err)
+	}
+
+	if tx.LocalAmount != -2050 || tx.LocalCurrency != "EUR" {
+		t.Errorf("expected local amount -2050 EUR, got %d %s", tx.LocalAmount, tx.LocalCurrency)
+	}
+	if tx.Categories["eating_out"] != -1234 || tx.Categories["holidays"] != -500 {
+		t.Errorf("unexpected categories: %v", tx.Categories)
+	}
+	if len(tx.Attachments) != 1 || tx.Attachments[0].FileType != "image/jpeg" {
+		t.Errorf("unexpected attachments: %+v", tx.Attachments)
+	}
+	if !tx.IncludeInSpending {
+		t.Error("expected IncludeInSpending to be true")
+	}
+	if tx.Scheme != "mastercard" {
+		t.Errorf("expected scheme 'mastercard', got %s", tx.Scheme)
+	}
+	if tx.DedupeID != "mastercard-1234567:2025-03-14:MFPRG1234" {
+		t.Errorf("unexpected dedupe ID: %s", tx.DedupeID)
+	}
+	if tx.AmountIsPending || tx.Originator {
+		t.Error("expected AmountIsPending and Originator to be false")
+	}
+	if !tx.Updated.Valid() {
+		t.Error("expected Updated to be set")
+	}
+	if tx.Counterparty == nil || *tx.Counterparty != (Counterparty{}) {
+		t.Errorf("expected an empty counterparty for a card payment, got %+v", tx.Counterparty)
+	}
+}
+
+func TestGetTransaction_FasterPaymentIn(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	// An incoming bank transfer, shaped like a real API response.
+	mockResponse := `
+	{
+		"transaction": {
+			"id": "tx_0000GgHhIiJjKkLl001",
+			"created": "2025-04-01T09:00:12.345Z",
+			"description": "RENT SHARE",
+			"amount": 45000,
+			"currency": "GBP",
+			"merchant": null,
+			"notes": "RENT SHARE",
+			"metadata": {"faster_payment": "true", "trn": "ABCD1234567890"},
+			"attachments": null,
+			"category": "transfers",
+			"categories": {"transfers": 45000},
+			"is_load": false,
+			"settled": "2025-04-01T09:00:12.345Z",
+			"local_amount": 45000,
+			"local_currency": "GBP",
+			"updated": "2025-04-01T09:00:13.001Z",
+			"account_id": "acc_0000GgHhIiJjKkLl002",
+			"user_id": "",
+			"counterparty": {
+				"account_number": "12345678",
+				"name": "Jane Smith",
+				"sort_code": "040004",
+				"user_id": "anonuser_0000GgHhIiJjKkLl003",
+				"beneficiary_account_type": "Personal"
+			},
+			"scheme": "payport_faster_payments",
+			"dedupe_id": "com.monzo.fps:9200:ABCD1234567890:INBOUND",
+			"originator": false,
+			"include_in_spending": false,
+			"amount_is_pending": false
+		}
+	}`
+
+	mux.HandleFunc("/transactions/tx_0000GgHhIiJjKkLl001", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, mockResponse)
+	})
+
+	tx, err := client.GetTransaction(context.Background(), "tx_0000GgHhIiJjKkLl001", false)
+	if err != nil {
+		t.Fatalf("GetTransaction returned an error: %v", err)
+	}
+
+	cp := tx.Counterparty
+	if cp == nil {
+		t.Fatal("expected a counterparty, got nil")
+	}
+	if cp.Name != "Jane Smith" {
+		t.Errorf("expected counterparty name 'Jane Smith', got %s", cp.Name)
+	}
+	if cp.SortCode != "040004" || cp.AccountNumber != "12345678" {
+		t.Errorf("unexpected sort code/account number: %s %s", cp.SortCode, cp.AccountNumber)
+	}
+	if cp.UserID != "anonuser_0000GgHhIiJjKkLl003" {
+		t.Errorf("unexpected counterparty user ID: %s", cp.UserID)
+	}
+	if tx.Scheme != "payport_faster_payments" {
+		t.Errorf("expected scheme 'payport_faster_payments', got %s", tx.Scheme)
+	}
+	if tx.Attachments != nil {
+		t.Errorf("expected no attachments, got %+v", tx.Attachments)
+	}
+	if tx.IncludeInSpending {
+		t.Error("expected IncludeInSpending to be false")
+	}
+}
+
+func TestListAccountsWithOptions(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mockResponse := `
+	{
+		"accounts": [
+			{
+				"id": "acc_001",
+				"closed": false,
+				"created": "2019-05-01T09:12:44.003Z",
+				"description": "user_001",
+				"type": "uk_retail",
+				"product_type": "standard",
+				"currency": "GBP",
+				"country_code": "GB",
+				"owners": [
+					{"user_id": "user_001", "preferred_name": "Alex Jones", "preferred_first_name": "Alex"}
+				],
+				"account_number": "12345678",
+				"sort_code": "040004"
+			},
+			{
+				"id": "acc_002",
+				"closed": true,
+				"created": "2020-02-01T10:00:00Z",
+				"description": "user_001",
+				"type": "uk_retail",
+				"product_type": "standard",
+				"currency": "GBP",
+				"country_code": "GB",
+				"owners": [{"user_id": "user_001", "preferred_name": "Alex Jones", "preferred_first_name": "Alex"}]
+			},
+			{
+				"id": "acc_003",
+				"closed": false,
+				"created": "2023-07-01T10:00:00Z",
+				"description": "Monzo Flex",
+				"type": "uk_monzo_flex",
+				"product_type": "flex",
+				"currency": "GBP",
+				"country_code": "GB",
+				"owners": [{"user_id": "user_001", "preferred_name": "Alex Jones", "preferred_first_name": "Alex"}]
+			}
+		]
+	}`
+
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, mockResponse)
+	})
+
+	ctx := context.Background()
+
+	all, err := client.ListAccountsWithOptions(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListAccountsWithOptions returned an error: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 accounts, got %d", len(all))
+	}
+	acc := all[0]
+	if acc.AccountNumber != "12345678" || acc.SortCode != "040004" {
+		t.Errorf("unexpected account number/sort code: %s %s", acc.AccountNumber, acc.SortCode)
+	}
+	if acc.Currency != "GBP" || acc.CountryCode != "GB" {
+		t.Errorf("unexpected currency/country: %s %s", acc.Currency, acc.CountryCode)
+	}
+	if len(acc.Owners) != 1 || acc.Owners[0].PreferredFirstName != "Alex" {
+		t.Errorf("unexpected owners: %+v", acc.Owners)
+	}
+	if !all[1].Closed {
+		t.Error("expected acc_002 to be closed")
+	}
+
+	open, err := client.ListAccountsWithOptions(ctx, &ListAccountsOptions{ExcludeClosed: true})
+	if err != nil {
+		t.Fatalf("ListAccountsWithOptions returned an error: %v", err)
+	}
+	if len(open) != 2 || open[0].ID != "acc_001" || open[1].ID != "acc_003" {
+		t.Errorf("expected open accounts acc_001 and acc_003, got %+v", open)
+	}
+
+	flex, err := client.ListAccountsWithOptions(ctx, &ListAccountsOptions{ProductTypes: []ProductType{ProductTypeFlex}})
+	if err != nil {
+		t.Fatalf("ListAccountsWithOptions returned an error: %v", err)
+	}
+	if len(flex) != 1 || flex[0].ID != "acc_003" {
+		t.Errorf("expected only the flex account, got %+v", flex)
+	}
+}
+
+// potsFixture is a /pots response with a live pot with a goal, a locked
+// pot, and a deleted pot.
+const potsFixture = `
+{
+	"pots": [
+		{
+			"id": "pot_001",
+			"name": "Holiday",
+			"style": "beach_ball",
+			"balance": 37500,
+			"currency": "GBP",
+			"goal_amount": 150000,
+			"type": "default",
+			"created": "2024-01-10T12:00:00.000Z",
+			"updated": "2025-03-01T08:30:00.000Z",
+			"deleted": false,
+			"round_up": true,
+			"locked": false,
+			"locked_until": null,
+			"available_for_bills": false,
+			"current_account_id": "acc_001",
+			"has_virtual_cards": true
+		},
+		{
+			"id": "pot_002",
+			"name": "Rainy Day",
+			"style": "blue",
+			"balance": 250000,
+			"currency": "GBP",
+			"goal_amount": null,
+			"type": "default",
+			"created": "2023-06-01T12:00:00.000Z",
+			"updated": "2025-02-01T08:30:00.000Z",
+			"deleted": false,
+			"round_up": false,
+			"locked": true,
+			"locked_until": "2026-01-01T00:00:00Z",
+			"available_for_bills": true,
+			"current_account_id": "acc_001",
+			"has_virtual_cards": false
+		},
+		{
+			"id": "pot_003",
+			"name": "Holiday",
+			"style": "green",
+			"balance": 0,
+			"currency": "GBP",
+			"created": "2022-01-01T12:00:00.000Z",
+			"updated": "2022-12-01T08:30:00.000Z",
+			"deleted": true,
+			"current_account_id": "acc_001"
+		}
+	]
+}`
+
+func TestListPotsWithOptions(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mux.HandleFunc("/pots", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, potsFixture)
+	})
+
+	ctx := context.Background()
+	pots, err := client.ListPotsWithOptions(ctx, "acc_001", nil)
+	if err != nil {
+		t.Fatalf("ListPotsWithOptions returned an error: %v", err)
+	}
+	if len(pots) != 3 {
+		t.Fatalf("expected 3 pots, got %d", len(pots))
+	}
+
+	holiday := pots[0]
+	if holiday.GoalAmount != 150000 || !holiday.RoundUp || !holiday.HasVirtualCards {
+		t.Errorf("unexpected holiday pot: %+v", holiday)
+	}
+	if holiday.CurrentAccountID != "acc_001" {
+		t.Errorf("expected current account acc_001, got %s", holiday.CurrentAccountID)
+	}
+	rainy := pots[1]
+	if !rainy.Locked || !rainy.LockedUntil.Valid() || !rainy.AvailableForBills {
+		t.Errorf("unexpected rainy day pot: %+v", rainy)
+	}
+
+	live, err := client.ListPotsWithOptions(ctx, "acc_001", &ListPotsOptions{ExcludeDeleted: true})
+	if err != nil {
+		t.Fatalf("ListPotsWithOptions returned an error: %v", err)
+	}
+	if len(live) != 2 {
+		t.Errorf("expected 2 live pots, got %d", len(live))
+	}
+}
+
+func TestGetPot(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"accounts": [{"id": "acc_001"}, {"id": "acc_002", "closed": true}]}`)
+	})
+	mux.HandleFunc("/pots", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("current_account_id"); got != "acc_001" {
+			t.Errorf("expected pots to be listed for acc_001 only, got %s", got)
+		}
+		fmt.Fprint(w, potsFixture)
+	})
+
+	ctx := context.Background()
+
+	pot, err := client.GetPot(ctx, "pot_002")
+	if err != nil {
+		t.Fatalf("GetPot by ID returned an error: %v", err)
+	}
+	if pot.Name != "Rainy Day" {
+		t.Errorf("expected 'Rainy Day', got %s", pot.Name)
+	}
+
+	// The deleted pot with the same name is ignored.
+	pot, err = client.GetPot(ctx, "holiday")
+	if err != nil {
+		t.Fatalf("GetPot by name returned an error: %v", err)
+	}
+	if pot.ID != "pot_001" {
+		t.Errorf("expected pot_001, got %s", pot.ID)
+	}
+
+	if _, err := client.GetPot(ctx, "Car"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPot_GoalHelpers(t *testing.T) {
+	pot := &Pot{Balance: 37500, GoalAmount: 150000, Currency: "GBP"}
+	if got := pot.GoalProgress(); got != 25 {
+		t.Errorf("expected 25%% progress, got %v", got)
+	}
+	if got := pot.GoalRemaining(); got != 112500 {
+		t.Errorf("expected 112500 remaining, got %d", got)
+	}
+	if got := pot.GoalRemainingMoney().String(); got != "£1,125.00" {
+		t.Errorf("expected £1,125.00 remaining, got %s", got)
+	}
+
+	met := &Pot{Balance: 2000, GoalAmount: 1000}
+	if met.GoalProgress() != 100 || met.GoalRemaining() != 0 {
+		t.Errorf("expected a met goal to be 100%% with nothing remaining, got %v / %d", met.GoalProgress(), met.GoalRemaining())
+	}
+
+	none := &Pot{Balance: 2000}
+	if none.HasGoal() || none.GoalProgress() != 0 || none.GoalRemaining() != 0 {
+		t.Error("expected a pot without a goal to report no progress")
+	}
+}
+
+func TestGetBalance_LocalSpend(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mockResponse := `
+	{
+		"balance": 12050,
+		"balance_including_flexible_savings": 62050,
+		"currency": "GBP",
+		"spend_today": -3420,
+		"total_balance": 87050,
+		"local_currency": "EUR",
+		"local_exchange_rate": 1.1812,
+		"local_spend": [
+			{"spend_today": -3000, "currency": "EUR"},
+			{"spend_today": -500, "currency": "CHF"}
+		]
+	}`
+
+	mux.HandleFunc("/balance", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, mockResponse)
+	})
+
+	balance, err := client.GetBalance(context.Background(), "acc_001")
+	if err != nil {
+		t.Fatalf("GetBalance returned an error: %v", err)
+	}
+	if balance.BalanceIncludingFlexibleSavings != 62050 {
+		t.Errorf("expected 62050 including flexible savings, got %d", balance.BalanceIncludingFlexibleSavings)
+	}
+	if balance.LocalCurrency != "EUR" || balance.LocalExchangeRate != 1.1812 {
+		t.Errorf("unexpected local currency/rate: %s %v", balance.LocalCurrency, balance.LocalExchangeRate)
+	}
+	if len(balance.LocalSpend) != 2 || balance.LocalSpend[1].Currency != "CHF" {
+		t.Errorf("unexpected local spend: %+v", balance.LocalSpend)
+	}
+}
+
+func TestGetBalance_AtHome(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	// At home, Monzo sends empty strings for the local fields.
+	mux.HandleFunc("/balance", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"balance": 100, "currency": "GBP", "local_currency": "", "local_exchange_rate": "", "local_spend": []}`)
+	})
+
+	balance, err := client.GetBalance(context.Background(), "acc_001")
+	if err != nil {
+		t.Fatalf("GetBalance returned an error: %v", err)
+	}
+	if balance.LocalExchangeRate != 0 || balance.LocalCurrency != "" {
+		t.Errorf("expected no local currency, got %s %v", balance.LocalCurrency, balance.LocalExchangeRate)
+	}
+}
+
+func TestGetBalances(t *testing.T) {
+	client, mux, teardown := setup(t, WithMaxConcurrency(2), WithRetryPolicy(NoRetries))
+	defer teardown()
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	mux.HandleFunc("/balance", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		id := r.URL.Query().Get("account_id")
+		if id == "acc_bad" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"balance": %d, "currency": "GBP"}`, len(id))
+	})
+
+	ids := []string{"acc_1", "acc_22", "acc_333", "acc_bad", "acc_4444"}
+	balances, err := client.GetBalances(context.Background(), ids...)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an error matching ErrNotFound, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "acc_bad") {
+		t.Errorf("expected the error to name acc_bad, got %v", err)
+	}
+	if len(balances) != 4 {
+		t.Fatalf("expected 4 balances, got %d", len(balances))
+	}
+	if balances["acc_333"].Balance != 7 {
+		t.Errorf("expected acc_333 balance 7, got %d", balances["acc_333"].Balance)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("expected at most 2 requests in flight, saw %d", maxInFlight)
+	}
+}
@@ -0,0 +1,86 @@
+package monzo
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures a Client. Options are passed to NewClient, after which
+// the client's configuration is fixed, so a single Client can safely be
+// shared between goroutines.
+type Option func(*Client)
+
+// WithBaseURL overrides the default BaseURL. This is primarily used for
+// testing purposes to point the client at a mock server.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithTimeout sets a default timeout for each API call, covering all of
+// its retry attempts. A deadline already set on the call's context is
+// still honoured if it is sooner. Zero means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetryPolicy overrides the DefaultRetryPolicy.
+// Use NoRetries to disable retries entirely.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// defaultMaxConcurrency is the default for WithMaxConcurrency.
+const defaultMaxConcurrency = 4
+
+// WithMaxConcurrency limits how many requests are made at once by methods
+// that fan out to several API calls, such as GetBalances. It defaults to 4.
+// Values below 1 are ignored.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Client) {
+		if n >= 1 {
+			c.maxConcurrency = n
+		}
+	}
+}
+
+// WithLogger sets a logger for the client. Each request is logged at debug
+// level, and retries at warn level. By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithRequestHook registers a function that is called with every outgoing
+// HTTP request, including retries, just before it is sent. Hooks may add
+// headers but must not read or replace the request body.
+// Multiple hooks are called in the order they were registered.
+func WithRequestHook(hook func(*http.Request)) Option {
+	return func(c *Client) {
+		c.requestHooks = append(c.requestHooks, hook)
+	}
+}
+
+// WithResponseHook registers a function that is called with every HTTP
+// response, including ones that will be retried, before its body is read.
+// Hooks must not read or close the response body.
+// Multiple hooks are called in the order they were registered.
+func WithResponseHook(hook func(*http.Response)) Option {
+	return func(c *Client) {
+		c.responseHooks = append(c.responseHooks, hook)
+	}
+}
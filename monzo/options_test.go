@@ -0,0 +1,74 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewClient_Options(t *testing.T) {
+	var sentHeader string
+	var gotStatus int
+
+	client, mux, teardown := setup(t,
+		WithUserAgent("my-app/1.0"),
+		WithRequestHook(func(r *http.Request) {
+			r.Header.Set("X-Request-Hook", "called")
+		}),
+		WithResponseHook(func(r *http.Response) {
+			gotStatus = r.StatusCode
+		}),
+	)
+	defer teardown()
+
+	mux.HandleFunc("/ping/whoami", func(w http.ResponseWriter, r *http.Request) {
+		if ua := r.Header.Get("User-Agent"); ua != "my-app/1.0" {
+			t.Errorf("expected User-Agent 'my-app/1.0', got %s", ua)
+		}
+		sentHeader = r.Header.Get("X-Request-Hook")
+		fmt.Fprint(w, `{"authenticated": true}`)
+	})
+
+	if _, err := client.WhoAmI(context.Background()); err != nil {
+		t.Fatalf("WhoAmI returned an error: %v", err)
+	}
+	if sentHeader != "called" {
+		t.Errorf("expected request hook to set header, got %q", sentHeader)
+	}
+	if gotStatus != http.StatusOK {
+		t.Errorf("expected response hook to see status 200, got %d", gotStatus)
+	}
+}
+
+func TestNewClient_Timeout(t *testing.T) {
+	client, mux, teardown := setup(t, WithTimeout(20*time.Millisecond), WithRetryPolicy(NoRetries))
+	defer teardown()
+
+	mux.HandleFunc("/ping/whoami", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	_, err := client.WhoAmI(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestNewClient_Defaults(t *testing.T) {
+	client := NewClient(nil)
+	if client.httpClient != http.DefaultClient {
+		t.Error("expected a nil http.Client to fall back to http.DefaultClient")
+	}
+	if client.baseURL != BaseURL {
+		t.Errorf("expected base URL %s, got %s", BaseURL, client.baseURL)
+	}
+	if client.retry != DefaultRetryPolicy {
+		t.Errorf("expected the default retry policy, got %+v", client.retry)
+	}
+}
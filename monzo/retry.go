@@ -0,0 +1,127 @@
+package monzo
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how the client retries failed requests.
+//
+// A request is retried when the API responds with 429 Too Many Requests
+// or a 5xx status, or when the request fails to reach the API at all.
+// By default only idempotent requests are retried: GET requests, and PUT
+// requests such as DepositToPot, WithdrawFromPot and CreateReceipt, which
+// carry a dedupe or external ID. Set RetryNonIdempotent to also retry
+// POST, PATCH and DELETE requests such as CreateFeedItem.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// A value of 1 or less disables retries.
+	MaxAttempts int
+	// InitialBackoff is the base delay before the first retry. The delay
+	// doubles on each subsequent retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. If the API asks us to
+	// wait longer than this via Retry-After, the client gives up instead.
+	// Zero means no cap.
+	MaxBackoff time.Duration
+	// RetryNonIdempotent allows retrying requests that are not known to
+	// be idempotent. Only enable this if duplicates are acceptable.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy is the retry policy used by clients created with
+// NewClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+}
+
+// NoRetries is a RetryPolicy that makes exactly one attempt per request.
+var NoRetries = RetryPolicy{MaxAttempts: 1}
+
+// allows reports whether a request with the given method may be retried.
+func (p RetryPolicy) allows(method string) bool {
+	if p.MaxAttempts <= 1 {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut:
+		return true
+	default:
+		return p.RetryNonIdempotent
+	}
+}
+
+// backoff returns the delay before the given retry (1 for the first retry),
+// using exponential backoff with "equal jitter": half the delay is fixed and
+// the other half is random, which spreads out clients retrying together.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d > 0; i++ {
+		if d > math.MaxInt64/2 {
+			d = math.MaxInt64
+			break
+		}
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// isRetryableStatus reports whether an HTTP status code indicates a
+// transient failure worth retrying.
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter parses a Retry-After header, which may be either a number
+// of seconds or an HTTP date. It returns false if the header is absent or
+// malformed.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
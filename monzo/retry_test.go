@@ -0,0 +1,229 @@
+package monzo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fastRetries is a retry policy with negligible backoff, so tests don't sleep.
+var fastRetries = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     10 * time.Millisecond,
+}
+
+func TestRetry_TransientErrorThenSuccess(t *testing.T) {
+	client, mux, teardown := setup(t, WithRetryPolicy(fastRetries))
+	defer teardown()
+
+	calls := 0
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"accounts": [{"id": "acc_001"}]}`)
+	})
+
+	accounts, err := client.ListAccounts(context.Background(), "")
+	if err != nil {
+		t.Fatalf("ListAccounts returned an error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+	if len(accounts) != 1 {
+		t.Errorf("expected 1 account, got %d", len(accounts))
+	}
+}
+
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	client, mux, teardown := setup(t, WithRetryPolicy(fastRetries))
+	defer teardown()
+
+	calls := 0
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, err := client.ListAccounts(context.Background(), "")
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected error type *APIError, got %T", err)
+	}
+	if apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected status code 500, got %d", apiErr.StatusCode)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestRetry_RespectsRetryAfter(t *testing.T) {
+	client, mux, teardown := setup(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, MaxBackoff: 5 * time.Second}))
+	defer teardown()
+
+	var first time.Time
+	var gap time.Duration
+	mux.HandleFunc("/balance", func(w http.ResponseWriter, r *http.Request) {
+		if first.IsZero() {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		gap = time.Since(first)
+		fmt.Fprint(w, `{"balance": 100}`)
+	})
+
+	if _, err := client.GetBalance(context.Background(), "acc_001"); err != nil {
+		t.Fatalf("GetBalance returned an error: %v", err)
+	}
+	if gap < time.Second {
+		t.Errorf("expected the client to wait at least 1s, waited %s", gap)
+	}
+}
+
+func TestRetry_RetryAfterBeyondMaxBackoff(t *testing.T) {
+	client, mux, teardown := setup(t, WithRetryPolicy(fastRetries))
+	defer teardown()
+
+	calls := 0
+	mux.HandleFunc("/balance", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	if _, err := client.GetBalance(context.Background(), "acc_001"); err == nil {
+		t.Fatal("expected an error, but got nil")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", calls)
+	}
+}
+
+func TestRetry_NonIdempotent(t *testing.T) {
+	t.Run("not retried by default", func(t *testing.T) {
+		client, mux, teardown := setup(t, WithRetryPolicy(fastRetries))
+		defer teardown()
+
+		calls := 0
+		mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadGateway)
+		})
+
+		err := client.CreateFeedItem(context.Background(), "acc_001", "basic", "", nil)
+		if err == nil {
+			t.Fatal("expected an error, but got nil")
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 attempt, got %d", calls)
+		}
+	})
+
+	t.Run("retried when opted in", func(t *testing.T) {
+		policy := fastRetries
+		policy.RetryNonIdempotent = true
+		client, mux, teardown := setup(t, WithRetryPolicy(policy))
+		defer teardown()
+
+		calls := 0
+		mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			r.ParseForm()
+			if r.PostForm.Get("account_id") != "acc_001" {
+				t.Errorf("attempt %d: expected account_id 'acc_001', got %s", calls, r.PostForm.Get("account_id"))
+			}
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		})
+
+		err := client.CreateFeedItem(context.Background(), "acc_001", "basic", "", nil)
+		if err != nil {
+			t.Fatalf("CreateFeedItem returned an error: %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("expected 2 attempts, got %d", calls)
+		}
+	})
+}
+
+func TestRetry_PotDepositIsRetried(t *testing.T) {
+	client, mux, teardown := setup(t, WithRetryPolicy(fastRetries))
+	defer teardown()
+
+	calls := 0
+	mux.HandleFunc("/pots/pot_001/deposit", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"id": "pot_001", "balance": 1000}`)
+	})
+
+	if _, err := client.DepositToPot(context.Background(), "pot_001", "acc_001", "dedupe-123", 1000); err != nil {
+		t.Fatalf("DepositToPot returned an error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"Wed, 01 Jan 2025 12:00:30 GMT", 30 * time.Second, true},
+		{"Wed, 01 Jan 2025 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.header, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		retry    int
+		min, max time.Duration
+	}{
+		{"first retry", RetryPolicy{InitialBackoff: time.Second}, 1, 500 * time.Millisecond, time.Second},
+		{"doubles without MaxBackoff", RetryPolicy{InitialBackoff: time.Second}, 4, 4 * time.Second, 8 * time.Second},
+		{"capped by MaxBackoff", RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}, 4, 1500 * time.Millisecond, 3 * time.Second},
+		{"no overflow", RetryPolicy{InitialBackoff: time.Second}, 100, math.MaxInt64 / 2, math.MaxInt64},
+		{"zero initial backoff", RetryPolicy{}, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			if got := tt.policy.backoff(tt.retry); got < tt.min || got > tt.max {
+				t.Errorf("%s: backoff(%d) = %s, want between %s and %s", tt.name, tt.retry, got, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package monzo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NullableTime is a timestamp that may be missing. Monzo sends optional
+// timestamps, such as Transaction.Settled for pending transactions, as an
+// empty string rather than omitting them, which time.Time can't decode.
+//
+// NullableTime accepts RFC3339 timestamps (with or without fractional
+// seconds), empty strings and null. A missing timestamp decodes to the
+// zero time, and is encoded back as an empty string.
+type NullableTime struct {
+	time.Time
+}
+
+// Valid reports whether the timestamp is set.
+func (t NullableTime) Valid() bool {
+	return !t.Time.IsZero()
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("monzo: invalid timestamp %s: %w", data, err)
+	}
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	// RFC3339Nano also accepts timestamps without fractional seconds.
+	parsed, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("monzo: invalid timestamp %q: %w", s, err)
+	}
+	t.Time = parsed
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t NullableTime) MarshalJSON() ([]byte, error) {
+	if !t.Valid() {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(t.Time.Format(time.RFC3339Nano))
+}
@@ -0,0 +1,90 @@
+package monzo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNullableTime_Unmarshal(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  time.Time
+		valid bool
+	}{
+		{"empty string", `""`, time.Time{}, false},
+		{"null", `null`, time.Time{}, false},
+		{"RFC3339", `"2015-09-05T14:28:40Z"`, time.Date(2015, 9, 5, 14, 28, 40, 0, time.UTC), true},
+		{"fractional seconds", `"2015-09-05T14:28:40.123Z"`, time.Date(2015, 9, 5, 14, 28, 40, 123_000_000, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nt NullableTime
+			if err := json.Unmarshal([]byte(tt.input), &nt); err != nil {
+				t.Fatalf("Unmarshal returned an error: %v", err)
+			}
+			if !nt.Time.Equal(tt.want) {
+				t.Errorf("expected %s, got %s", tt.want, nt.Time)
+			}
+			if nt.Valid() != tt.valid {
+				t.Errorf("expected Valid() %v, got %v", tt.valid, nt.Valid())
+			}
+			if nt.IsZero() == tt.valid {
+				t.Errorf("expected IsZero() %v, got %v", !tt.valid, nt.IsZero())
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		var nt NullableTime
+		if err := json.Unmarshal([]byte(`"yesterday"`), &nt); err == nil {
+			t.Error("expected an error for an invalid timestamp, got nil")
+		}
+	})
+}
+
+func TestNullableTime_RoundTrip(t *testing.T) {
+	for _, input := range []string{`""`, `"2015-09-05T14:28:40.5Z"`} {
+		var nt NullableTime
+		if err := json.Unmarshal([]byte(input), &nt); err != nil {
+			t.Fatalf("Unmarshal(%s) returned an error: %v", input, err)
+		}
+		out, err := json.Marshal(nt)
+		if err != nil {
+			t.Fatalf("Marshal returned an error: %v", err)
+		}
+		if string(out) != input {
+			t.Errorf("expected %s to round-trip, got %s", input, out)
+		}
+	}
+}
+
+func TestListTransactions_PendingTransaction(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `
+		{
+			"transactions": [
+				{"id": "tx_001", "created": "2025-01-01T10:00:00.123Z", "settled": "2025-01-02T04:00:00.456Z"},
+				{"id": "tx_002", "created": "2025-01-03T10:00:00.789Z", "settled": ""}
+			]
+		}`)
+	})
+
+	txs, err := client.ListTransactions(context.Background(), "acc_001", nil)
+	if err != nil {
+		t.Fatalf("ListTransactions returned an error: %v", err)
+	}
+	if !txs[0].Settled.Valid() {
+		t.Error("expected the first transaction to be settled")
+	}
+	if txs[1].Settled.Valid() {
+		t.Error("expected the second transaction to be pending")
+	}
+}
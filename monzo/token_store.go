@@ -0,0 +1,280 @@
+package monzo
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoToken is returned by TokenStore.Load when no token has been saved.
+var ErrNoToken = errors.New("monzo: no token saved")
+
+// TokenStore saves an OAuth2 token between runs, so users don't have to
+// log in every time. Implementations must be safe for concurrent use.
+type TokenStore interface {
+	// Load returns the saved token, or ErrNoToken if there isn't one.
+	Load(ctx context.Context) (*oauth2.Token, error)
+	// Save replaces the saved token.
+	Save(ctx context.Context, token *oauth2.Token) error
+}
+
+// MemoryTokenStore is a TokenStore that keeps the token in memory. It is
+// mainly useful in tests.
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// NewMemoryTokenStore returns a MemoryTokenStore holding token, which may
+// be nil.
+func NewMemoryTokenStore(token *oauth2.Token) *MemoryTokenStore {
+	s := &MemoryTokenStore{}
+	if token != nil {
+		s.token = copyToken(token)
+	}
+	return s
+}
+
+// Load implements TokenStore.
+func (s *MemoryTokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return nil, ErrNoToken
+	}
+	return copyToken(s.token), nil
+}
+
+// Save implements TokenStore.
+func (s *MemoryTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = copyToken(token)
+	return nil
+}
+
+// copyToken returns a copy of token, so that callers can't modify a
+// stored token.
+func copyToken(token *oauth2.Token) *oauth2.Token {
+	t := *token
+	return &t
+}
+
+// FileTokenStore is a TokenStore that saves the token as plain JSON in a
+// file readable only by its owner. Anyone who can read the file can use
+// the token; see EncryptedFileTokenStore for an alternative.
+type FileTokenStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileTokenStore returns a FileTokenStore saving to path. The file and
+// its directory are created when a token is first saved.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{path: path}
+}
+
+// Load implements TokenStore.
+func (s *FileTokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := readTokenFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeToken(data)
+}
+
+// Save implements TokenStore. The file is replaced atomically, so a crash
+// never leaves it half written.
+func (s *FileTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("monzo: encode token: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(s.path, data)
+}
+
+// EncryptedFileTokenStore is a TokenStore that saves the token in a file
+// encrypted with AES-GCM, so the file is useless without the key.
+type EncryptedFileTokenStore struct {
+	path string
+	aead cipher.AEAD
+	mu   sync.Mutex
+}
+
+// NewEncryptedFileTokenStore returns an EncryptedFileTokenStore saving to
+// path. key must be 16, 24 or 32 bytes long, selecting AES-128, AES-192
+// or AES-256, and should come from somewhere other than the disk, such as
+// the OS keychain or an environment variable.
+func NewEncryptedFileTokenStore(path string, key []byte) (*EncryptedFileTokenStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("monzo: token key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("monzo: token key: %w", err)
+	}
+	return &EncryptedFileTokenStore{path: path, aead: aead}, nil
+}
+
+// Load implements TokenStore. It returns an error if the file was
+// encrypted with a different key or has been tampered with.
+func (s *EncryptedFileTokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := readTokenFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := s.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("monzo: decrypt token file %s: file too short", s.path)
+	}
+	plaintext, err := s.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("monzo: decrypt token file %s: wrong key or corrupted file", s.path)
+	}
+	return decodeToken(plaintext)
+}
+
+// Save implements TokenStore. The file holds a random nonce followed by
+// the sealed token, and is replaced atomically.
+func (s *EncryptedFileTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	plaintext, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("monzo: encode token: %w", err)
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("monzo: encrypt token: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(s.path, s.aead.Seal(nonce, nonce, plaintext, nil))
+}
+
+// readTokenFile reads a token file, returning ErrNoToken if it doesn't
+// exist.
+func readTokenFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("monzo: read token file: %w", err)
+	}
+	return data, nil
+}
+
+// decodeToken decodes a token saved as JSON.
+func decodeToken(data []byte) (*oauth2.Token, error) {
+	var token oauth2.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("monzo: decode token: %w", err)
+	}
+	return &token, nil
+}
+
+// writeFileAtomic replaces the file at path with data, readable only by
+// its owner, by writing a temporary file and renaming it over path. The
+// directory is created if needed.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("monzo: save token: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("monzo: save token: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("monzo: save token: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("monzo: save token: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("monzo: save token: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("monzo: save token: %w", err)
+	}
+	return nil
+}
+
+// persistingTokenSource saves every new token its source returns.
+type persistingTokenSource struct {
+	ctx   context.Context
+	src   oauth2.TokenSource
+	store TokenStore
+
+	mu    sync.Mutex
+	saved *oauth2.Token
+}
+
+// PersistingTokenSource returns a TokenSource that returns src's tokens,
+// saving each new one to store before returning it. Wrap the source that
+// refreshes tokens, such as one from oauth2.Config.TokenSource, so that a
+// rotated refresh token is never lost:
+//
+//	ts := monzo.PersistingTokenSource(ctx, cfg.TokenSource(ctx, token), store)
+//	client := monzo.NewClient(oauth2.NewClient(ctx, ts))
+//
+// Tokens are compared by access and refresh token, so src may return the
+// same token many times. If saving fails, Token returns the error and
+// tries again on the next call. ctx is passed to store.
+func PersistingTokenSource(ctx context.Context, src oauth2.TokenSource, store TokenStore) oauth2.TokenSource {
+	return &persistingTokenSource{ctx: ctx, src: src, store: store}
+}
+
+// Token implements oauth2.TokenSource.
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saved != nil && s.saved.AccessToken == token.AccessToken && s.saved.RefreshToken == token.RefreshToken {
+		return token, nil
+	}
+	if err := s.store.Save(s.ctx, token); err != nil {
+		return nil, err
+	}
+	s.saved = token
+	return token, nil
+}
+
+// StoredTokenSource loads the token saved in store and returns a
+// TokenSource that refreshes it with cfg, saving each refreshed token back
+// to store. It returns ErrNoToken if no token has been saved, in which
+// case the user needs to log in.
+func StoredTokenSource(ctx context.Context, cfg *oauth2.Config, store TokenStore) (oauth2.TokenSource, error) {
+	token, err := store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &persistingTokenSource{ctx: ctx, src: cfg.TokenSource(ctx, token), store: store, saved: token}, nil
+}
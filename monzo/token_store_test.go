@@ -0,0 +1,192 @@
+package monzo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func testToken(access string) *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		RefreshToken: "refresh_" + access,
+		Expiry:       time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// testTokenStore checks the behaviour every TokenStore shares.
+func testTokenStore(t *testing.T, store TokenStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := store.Load(ctx); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("expected ErrNoToken from an empty store, got %v", err)
+	}
+	for _, access := range []string{"access_1", "access_2"} {
+		if err := store.Save(ctx, testToken(access)); err != nil {
+			t.Fatalf("Save returned an error: %v", err)
+		}
+		token, err := store.Load(ctx)
+		if err != nil {
+			t.Fatalf("Load returned an error: %v", err)
+		}
+		if token.AccessToken != access || token.RefreshToken != "refresh_"+access {
+			t.Errorf("expected the %s token, got %+v", access, token)
+		}
+		if !token.Expiry.Equal(testToken(access).Expiry) {
+			t.Errorf("expected expiry to be kept, got %s", token.Expiry)
+		}
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	testTokenStore(t, NewMemoryTokenStore(nil))
+
+	token := testToken("access_1")
+	store := NewMemoryTokenStore(token)
+	token.AccessToken = "changed"
+	if got, _ := store.Load(context.Background()); got.AccessToken != "access_1" {
+		t.Errorf("expected the store to keep its own copy, got %s", got.AccessToken)
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "my-app")
+	path := filepath.Join(dir, "token.json")
+	testTokenStore(t, NewFileTokenStore(path))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat returned an error: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("expected the file to be private, got %v", perm)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, got %d entries", len(entries))
+	}
+
+	os.WriteFile(path, []byte("{not json"), 0o600)
+	if _, err := NewFileTokenStore(path).Load(context.Background()); err == nil {
+		t.Error("expected an error for a corrupted file")
+	}
+}
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.enc")
+	key := bytes.Repeat([]byte{1}, 32)
+	store, err := NewEncryptedFileTokenStore(path, key)
+	if err != nil {
+		t.Fatalf("NewEncryptedFileTokenStore returned an error: %v", err)
+	}
+	testTokenStore(t, store)
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("access_2")) {
+		t.Error("expected the token not to be saved in plaintext")
+	}
+
+	other, _ := NewEncryptedFileTokenStore(path, bytes.Repeat([]byte{2}, 32))
+	if _, err := other.Load(context.Background()); err == nil {
+		t.Error("expected an error loading with the wrong key")
+	}
+
+	if _, err := NewEncryptedFileTokenStore(path, []byte("short")); err == nil {
+		t.Error("expected an error for an invalid key length")
+	}
+}
+
+// tokenSourceFunc adapts a function to oauth2.TokenSource.
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) { return f() }
+
+// failingTokenStore fails to save while fail is set.
+type failingTokenStore struct {
+	*MemoryTokenStore
+	fail  bool
+	saves int
+}
+
+func (s *failingTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	s.saves++
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryTokenStore.Save(ctx, token)
+}
+
+func TestPersistingTokenSource(t *testing.T) {
+	ctx := context.Background()
+	current := testToken("access_1")
+	src := tokenSourceFunc(func() (*oauth2.Token, error) { return current, nil })
+	store := &failingTokenStore{MemoryTokenStore: NewMemoryTokenStore(nil)}
+	ts := PersistingTokenSource(ctx, src, store)
+
+	for range 3 {
+		if _, err := ts.Token(); err != nil {
+			t.Fatalf("Token returned an error: %v", err)
+		}
+	}
+	if store.saves != 1 {
+		t.Errorf("expected an unchanged token to be saved once, got %d saves", store.saves)
+	}
+
+	// A refresh that fails to save is reported, and retried next time.
+	current = testToken("access_2")
+	store.fail = true
+	if _, err := ts.Token(); err == nil {
+		t.Error("expected the save error to be returned")
+	}
+	store.fail = false
+	if _, err := ts.Token(); err != nil {
+		t.Fatalf("Token returned an error: %v", err)
+	}
+	if saved, _ := store.Load(ctx); saved.AccessToken != "access_2" {
+		t.Errorf("expected the refreshed token to be saved, got %s", saved.AccessToken)
+	}
+}
+
+func TestStoredTokenSource(t *testing.T) {
+	ctx := context.Background()
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh_old" {
+			t.Errorf("unexpected token request: %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "access_new", "token_type": "Bearer", "refresh_token": "refresh_new", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+	cfg := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+
+	store := NewMemoryTokenStore(nil)
+	if _, err := StoredTokenSource(ctx, cfg, store); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("expected ErrNoToken, got %v", err)
+	}
+
+	store.Save(ctx, &oauth2.Token{AccessToken: "access_old", RefreshToken: "refresh_old", Expiry: time.Now().Add(-time.Hour)})
+	ts, err := StoredTokenSource(ctx, cfg, store)
+	if err != nil {
+		t.Fatalf("StoredTokenSource returned an error: %v", err)
+	}
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token returned an error: %v", err)
+	}
+	if token.AccessToken != "access_new" {
+		t.Errorf("expected a refreshed token, got %s", token.AccessToken)
+	}
+	saved, _ := store.Load(ctx)
+	if saved.RefreshToken != "refresh_new" {
+		t.Errorf("expected the rotated refresh token to be saved, got %s", saved.RefreshToken)
+	}
+}
@@ -0,0 +1,365 @@
+package monzo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// WebhookEventType is the type of a webhook event, e.g. "transaction.created".
+type WebhookEventType string
+
+// Known webhook event types.
+const (
+	// WebhookTransactionCreated is sent when a transaction is created.
+	WebhookTransactionCreated WebhookEventType = "transaction.created"
+	// WebhookTransactionUpdated is sent when a transaction changes, e.g.
+	// when it settles or is annotated.
+	WebhookTransactionUpdated WebhookEventType = "transaction.updated"
+)
+
+// String returns the event type as sent by Monzo.
+func (t WebhookEventType) String() string { return string(t) }
+
+// maxWebhookBodyBytes limits the size of webhook request bodies, to
+// prevent abuse.
+const maxWebhookBodyBytes = 1_048_576
+
+// webhookRegistry maps event types to constructors for their payloads.
+var webhookRegistry = struct {
+	sync.RWMutex
+	types map[WebhookEventType]func() any
+}{
+	types: map[WebhookEventType]func() any{
+		WebhookTransactionCreated: func() any { return new(Transaction) },
+		WebhookTransactionUpdated: func() any { return new(Transaction) },
+	},
+}
+
+// RegisterWebhookEventType registers the Go type of the payload for an
+// event type, so WebhookEvent.Payload can decode it. newPayload must
+// return a pointer to a new value to decode into, e.g.
+//
+//	monzo.RegisterWebhookEventType("account.updated", func() any { return new(AccountUpdate) })
+//
+// Registering a type that is already registered replaces it. The
+// transaction.created and transaction.updated events are registered by
+// default, with *Transaction payloads.
+func RegisterWebhookEventType(eventType WebhookEventType, newPayload func() any) {
+	webhookRegistry.Lock()
+	defer webhookRegistry.Unlock()
+	webhookRegistry.types[eventType] = newPayload
+}
+
+// lookupWebhookEventType returns the payload constructor for an event
+// type, if one is registered.
+func lookupWebhookEventType(eventType WebhookEventType) (func() any, bool) {
+	webhookRegistry.RLock()
+	defer webhookRegistry.RUnlock()
+	newPayload, ok := webhookRegistry.types[eventType]
+	return newPayload, ok
+}
+
+// WebhookOption configures a WebhookHandler, or how ParseWebhookEvent
+// parses a single request.
+type WebhookOption func(*webhookConfig)
+
+// webhookConfig holds the settings applied by WebhookOptions.
+type webhookConfig struct {
+	maxBodyBytes int64
+	strict       bool
+	deduper      WebhookDeduper
+
+	secret        string
+	checkSecret   bool
+	confirmClient *Client
+	panicPolicy   WebhookPanicPolicy
+	errorHandler  func(*http.Request, error)
+}
+
+// newWebhookConfig returns the default config with opts applied.
+func newWebhookConfig(opts []WebhookOption) *webhookConfig {
+	cfg := &webhookConfig{maxBodyBytes: maxWebhookBodyBytes}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithWebhookMaxBodyBytes sets the largest request body that will be read.
+// WebhookHandler rejects larger requests with 413. It defaults to 1MB.
+// Values below 1 are ignored.
+func WithWebhookMaxBodyBytes(n int64) WebhookOption {
+	return func(cfg *webhookConfig) {
+		if n >= 1 {
+			cfg.maxBodyBytes = n
+		}
+	}
+}
+
+// WithStrictWebhookDecoding makes parsing fail if the event, or the
+// payload of a registered event type, has fields this package doesn't
+// know about.
+//
+// By default decoding is lenient: unknown fields are ignored, and kept in
+// WebhookEvent.Extra so that changes to Monzo's schema can be logged
+// rather than losing events.
+func WithStrictWebhookDecoding() WebhookOption {
+	return func(cfg *webhookConfig) {
+		cfg.strict = true
+	}
+}
+
+// ParseWebhookEvent parses any webhook event from an incoming HTTP request.
+//
+// Events of any type are returned, including types that aren't registered
+// with RegisterWebhookEventType; check Known, or switch on Type. An error
+// is only returned if the body can't be read or isn't a valid event.
+//
+// With WithWebhookDeduper, the event is claimed before it is returned, and
+// ErrDuplicateWebhook is returned instead if it has already been handled
+// or is being handled. The caller must then call the event's MarkHandled
+// method once it has handled it, or Release if it couldn't:
+//
+//	event, err := monzo.ParseWebhookEvent(r, monzo.WithWebhookDeduper(d))
+//	if errors.Is(err, monzo.ErrDuplicateWebhook) {
+//		w.WriteHeader(http.StatusOK)
+//		return
+//	}
+//	...
+//	if err := handle(event); err != nil {
+//		event.Release(ctx)
+//		w.WriteHeader(http.StatusInternalServerError)
+//		return
+//	}
+//	event.MarkHandled(ctx)
+func ParseWebhookEvent(r *http.Request, opts ...WebhookOption) (*WebhookEvent, error) {
+	cfg := newWebhookConfig(opts)
+	if cfg.checkSecret {
+		if err := VerifyWebhookSecret(r, cfg.secret); err != nil {
+			r.Body.Close()
+			return nil, err
+		}
+	}
+
+	event, err := parseWebhookEvent(nil, r, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := confirmWebhookEvent(r.Context(), cfg, event); err != nil {
+		return nil, err
+	}
+
+	if cfg.deduper != nil {
+		key := WebhookDedupeKey(event)
+		claimed, err := cfg.deduper.Claim(r.Context(), key)
+		if err != nil {
+			return nil, fmt.Errorf("monzo: claim webhook: %w", err)
+		}
+		if !claimed {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateWebhook, key)
+		}
+		event.deduper, event.dedupeKey = cfg.deduper, key
+	}
+	return event, nil
+}
+
+// parseWebhookEvent decodes a webhook event from r according to cfg.
+// w may be nil; see http.MaxBytesReader.
+func parseWebhookEvent(w http.ResponseWriter, r *http.Request, cfg *webhookConfig) (*WebhookEvent, error) {
+	// Good practice: defer body closing
+	defer r.Body.Close()
+
+	// Good practice: limit the request body size to prevent abuse
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.maxBodyBytes)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook body: %w", err)
+	}
+
+	event := WebhookEvent{strict: cfg.strict}
+	if cfg.strict {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&event)
+	} else {
+		err = json.Unmarshal(body, &event)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode webhook JSON: %w", err)
+	}
+	if event.Type == "" {
+		return nil, fmt.Errorf("failed to decode webhook JSON: missing event type")
+	}
+
+	if cfg.strict {
+		// Check the payload now, so that unknown fields are reported
+		// here rather than when it's first decoded.
+		if _, err := event.Payload(); err != nil {
+			return nil, err
+		}
+	} else {
+		event.Extra = unknownWebhookFields(body, event.Type)
+	}
+
+	return &event, nil
+}
+
+// unknownWebhookFields returns the fields of the event in body that aren't
+// part of the envelope, or of the top level of the payload type registered
+// for eventType. Payload fields are prefixed with "data.". It returns nil
+// if there are none.
+func unknownWebhookFields(body []byte, eventType WebhookEventType) map[string]json.RawMessage {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil
+	}
+
+	extra := make(map[string]json.RawMessage)
+	for name, value := range envelope {
+		if name != "type" && name != "data" {
+			extra[name] = value
+		}
+	}
+
+	if newPayload, ok := lookupWebhookEventType(eventType); ok {
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(envelope["data"], &data); err == nil {
+			known := jsonFieldNames(reflect.TypeOf(newPayload()))
+			for name, value := range data {
+				if !known[strings.ToLower(name)] {
+					extra["data."+name] = value
+				}
+			}
+		}
+	}
+
+	if len(extra) == 0 {
+		return nil
+	}
+	return extra
+}
+
+// jsonFieldNames returns the lower-cased JSON names of the fields of the
+// struct t (or *t), following the rules of encoding/json.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	names := make(map[string]bool)
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			for embedded := range jsonFieldNames(f.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
+
+// MarkHandled records that the event has been handled, so redeliveries of
+// it are dropped. It does nothing unless the event was parsed by
+// ParseWebhookEvent with WithWebhookDeduper.
+func (e *WebhookEvent) MarkHandled(ctx context.Context) error {
+	if e.deduper == nil {
+		return nil
+	}
+	d := e.deduper
+	e.deduper = nil
+	if err := d.Mark(ctx, e.dedupeKey); err != nil {
+		return fmt.Errorf("monzo: mark webhook: %w", err)
+	}
+	return nil
+}
+
+// Release gives up the claim ParseWebhookEvent took on the event, so a
+// redelivery of it will be handled. It does nothing unless the event was
+// parsed with WithWebhookDeduper, or after MarkHandled.
+func (e *WebhookEvent) Release(ctx context.Context) error {
+	if e.deduper == nil {
+		return nil
+	}
+	d := e.deduper
+	e.deduper = nil
+	if err := d.Release(ctx, e.dedupeKey); err != nil {
+		return fmt.Errorf("monzo: release webhook: %w", err)
+	}
+	return nil
+}
+
+// Known reports whether the event's type has a registered payload type.
+func (e *WebhookEvent) Known() bool {
+	_, ok := lookupWebhookEventType(e.Type)
+	return ok
+}
+
+// Decode decodes the event's payload into v. If the event was parsed with
+// WithStrictWebhookDecoding, fields that v has no place for are an error.
+func (e *WebhookEvent) Decode(v any) error {
+	dec := json.NewDecoder(bytes.NewReader(e.Data))
+	if e.strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s webhook data: %w", e.Type, err)
+	}
+	return nil
+}
+
+// Payload decodes the event's payload into the Go type registered for its
+// event type, returning a pointer such as *Transaction. For event types
+// that aren't registered, it returns the raw Data as a json.RawMessage.
+func (e *WebhookEvent) Payload() (any, error) {
+	newPayload, ok := lookupWebhookEventType(e.Type)
+	if !ok {
+		return e.Data, nil
+	}
+	v := newPayload()
+	if err := e.Decode(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Transaction decodes the payload of a transaction event, such as
+// transaction.created or transaction.updated. It returns an error if the
+// event type's registered payload is not a Transaction.
+func (e *WebhookEvent) Transaction() (*Transaction, error) {
+	newPayload, ok := lookupWebhookEventType(e.Type)
+	if !ok {
+		return nil, fmt.Errorf("monzo: %s webhook is not a transaction event", e.Type)
+	}
+	if _, isTx := newPayload().(*Transaction); !isTx {
+		return nil, fmt.Errorf("monzo: %s webhook is not a transaction event", e.Type)
+	}
+
+	var tx Transaction
+	if err := e.Decode(&tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
@@ -0,0 +1,401 @@
+package monzo
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookDeduper records which webhook deliveries are being or have been
+// handled, so that redeliveries of the same event can be ignored. Keys are
+// built by WebhookDedupeKey. Implementations must be safe for concurrent
+// use.
+//
+// Handling an event takes a claim on its key, which is then either marked,
+// once the event has been handled, or released, if handling failed:
+//
+//	key := monzo.WebhookDedupeKey(event)
+//	if claimed, err := d.Claim(ctx, key); err != nil || !claimed {
+//		return err // a duplicate, or already being handled
+//	}
+//	if err := handle(event); err != nil {
+//		d.Release(ctx, key)
+//		return err
+//	}
+//	return d.Mark(ctx, key)
+type WebhookDeduper interface {
+	// Claim atomically claims key for handling. It returns false if key
+	// is already claimed, or has been marked and not yet expired.
+	Claim(ctx context.Context, key string) (bool, error)
+	// Release gives up a claim on key, so a redelivery can be handled.
+	Release(ctx context.Context, key string) error
+	// Mark records that the event with the claimed key has been handled.
+	Mark(ctx context.Context, key string) error
+}
+
+// ErrDuplicateWebhook is returned by ParseWebhookEvent with
+// WithWebhookDeduper for an event that has already been handled, or is
+// being handled. Respond 200 so Monzo stops redelivering it.
+var ErrDuplicateWebhook = errors.New("monzo: duplicate webhook")
+
+// WithWebhookDeduper makes WebhookHandler drop webhooks that d has already
+// seen. Duplicates, and redeliveries that arrive while the first delivery
+// is still being handled, are acknowledged with 200 without calling any
+// callbacks. An event is only marked once all its callbacks have
+// succeeded; if one fails, the claim is released so Monzo's retry is
+// handled.
+//
+// ParseWebhookEvent returns ErrDuplicateWebhook for such webhooks, and
+// leaves marking or releasing the event to the caller; see its example.
+// ParseWebhookTransactionCreated rejects this option.
+func WithWebhookDeduper(d WebhookDeduper) WebhookOption {
+	return func(cfg *webhookConfig) {
+		cfg.deduper = d
+	}
+}
+
+// WebhookDedupeKey returns the key that identifies a webhook delivery for
+// deduplication: the event type, the ID of its payload (such as the
+// transaction ID) and a hash of the payload. An event that is updated
+// again, e.g. a transaction.updated for a later change, gets a new key.
+func WebhookDedupeKey(e *WebhookEvent) string {
+	var payload struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(e.Data, &payload)
+
+	// Hash the compacted payload, so that whitespace doesn't matter.
+	var compact bytes.Buffer
+	data := []byte(e.Data)
+	if json.Compact(&compact, e.Data) == nil {
+		data = compact.Bytes()
+	}
+	sum := sha256.Sum256(data)
+
+	return fmt.Sprintf("%s:%s:%s", e.Type, payload.ID, hex.EncodeToString(sum[:]))
+}
+
+// MemoryDeduper is a WebhookDeduper that keeps keys in memory, evicting
+// the least recently used marked key once it is full. Claimed keys aren't
+// counted or evicted.
+type MemoryDeduper struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // of *memoryDedupeEntry, most recently used first
+	keys    map[string]*list.Element
+	claimed map[string]bool
+}
+
+type memoryDedupeEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryDeduper creates a MemoryDeduper that holds at most size keys,
+// each for ttl. A size below 1 means no limit, and a ttl of zero means
+// keys never expire.
+func NewMemoryDeduper(size int, ttl time.Duration) *MemoryDeduper {
+	return &MemoryDeduper{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		keys:    make(map[string]*list.Element),
+		claimed: make(map[string]bool),
+	}
+}
+
+// Claim implements WebhookDeduper.
+func (d *MemoryDeduper) Claim(ctx context.Context, key string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.claimed[key] {
+		return false, nil
+	}
+	if el, ok := d.keys[key]; ok {
+		entry := el.Value.(*memoryDedupeEntry)
+		if entry.expires.IsZero() || d.now().Before(entry.expires) {
+			d.order.MoveToFront(el)
+			return false, nil
+		}
+		d.order.Remove(el)
+		delete(d.keys, key)
+	}
+	d.claimed[key] = true
+	return true, nil
+}
+
+// Release implements WebhookDeduper.
+func (d *MemoryDeduper) Release(ctx context.Context, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.claimed, key)
+	return nil
+}
+
+// Mark implements WebhookDeduper.
+func (d *MemoryDeduper) Mark(ctx context.Context, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.claimed, key)
+
+	var expires time.Time
+	if d.ttl > 0 {
+		expires = d.now().Add(d.ttl)
+	}
+
+	if el, ok := d.keys[key]; ok {
+		el.Value.(*memoryDedupeEntry).expires = expires
+		d.order.MoveToFront(el)
+		return nil
+	}
+	d.keys[key] = d.order.PushFront(&memoryDedupeEntry{key: key, expires: expires})
+
+	for d.size > 0 && d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.keys, oldest.Value.(*memoryDedupeEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of marked keys held, including any that have
+// expired but not yet been evicted.
+func (d *MemoryDeduper) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.order.Len()
+}
+
+// fileDedupeCompactLines is the fewest lines a FileDeduper's file holds
+// before it is compacted.
+const fileDedupeCompactLines = 1024
+
+// FileDeduper is a WebhookDeduper that persists marked keys to a file, so
+// that duplicates are still recognised after a restart. Claims are only
+// held in memory. Keys are appended to the file as they are marked; the
+// file is rewritten without expired keys when it is opened, and whenever
+// it has grown to twice the number of keys held (and at least 1024
+// lines), so it stays in proportion to the keys within their ttl.
+//
+// A FileDeduper must not share its file with another process.
+type FileDeduper struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu        sync.Mutex
+	file      *os.File
+	keys      map[string]time.Time // zero time means no expiry
+	claimed   map[string]bool
+	lines     int // lines in the file
+	compactAt int // lines at which to compact the file
+}
+
+// NewFileDeduper opens or creates the deduplication file at path, keeping
+// each key for ttl. A ttl of zero means keys never expire.
+func NewFileDeduper(path string, ttl time.Duration) (*FileDeduper, error) {
+	d := &FileDeduper{
+		path:    path,
+		ttl:     ttl,
+		now:     time.Now,
+		keys:    make(map[string]time.Time),
+		claimed: make(map[string]bool),
+	}
+	if err := d.load(path); err != nil {
+		return nil, err
+	}
+	if err := d.compact(path); err != nil {
+		return nil, err
+	}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// open opens the file for appending, and sets when it is next compacted.
+func (d *FileDeduper) open() error {
+	f, err := os.OpenFile(d.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("monzo: open dedupe file: %w", err)
+	}
+	d.file = f
+	d.lines = len(d.keys)
+	d.compactAt = max(2*len(d.keys), fileDedupeCompactLines)
+	return nil
+}
+
+// recompact drops expired keys and rewrites the file with the rest.
+// d.mu must be held.
+func (d *FileDeduper) recompact() error {
+	now := d.now()
+	for key, expires := range d.keys {
+		if !expires.IsZero() && !now.Before(expires) {
+			delete(d.keys, key)
+		}
+	}
+	if err := d.file.Close(); err != nil {
+		return fmt.Errorf("monzo: compact dedupe file: %w", err)
+	}
+	if err := d.compact(d.path); err != nil {
+		// Keep appending to the old file; it still holds every key.
+		if openErr := d.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	return d.open()
+}
+
+// load reads the unexpired keys from the file at path, if it exists.
+// Each line is a key and its expiry in Unix seconds, separated by a tab.
+func (d *FileDeduper) load(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("monzo: open dedupe file: %w", err)
+	}
+	defer f.Close()
+
+	now := d.now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, expiresStr, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue // skip lines left partly written by a crash
+		}
+		unix, err := strconv.ParseInt(expiresStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		var expires time.Time
+		if unix != 0 {
+			expires = time.Unix(unix, 0)
+			if !now.Before(expires) {
+				continue
+			}
+		}
+		d.keys[key] = expires
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("monzo: read dedupe file: %w", err)
+	}
+	return nil
+}
+
+// compact atomically rewrites the file at path with only the loaded keys.
+func (d *FileDeduper) compact(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("monzo: compact dedupe file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for key, expires := range d.keys {
+		fmt.Fprint(w, dedupeLine(key, expires))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("monzo: compact dedupe file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("monzo: compact dedupe file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("monzo: compact dedupe file: %w", err)
+	}
+	return nil
+}
+
+// dedupeLine formats a key for the dedupe file.
+func dedupeLine(key string, expires time.Time) string {
+	var unix int64
+	if !expires.IsZero() {
+		unix = expires.Unix()
+	}
+	return key + "\t" + strconv.FormatInt(unix, 10) + "\n"
+}
+
+// Claim implements WebhookDeduper.
+func (d *FileDeduper) Claim(ctx context.Context, key string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.claimed[key] {
+		return false, nil
+	}
+	if expires, ok := d.keys[key]; ok {
+		if expires.IsZero() || d.now().Before(expires) {
+			return false, nil
+		}
+		delete(d.keys, key)
+	}
+	d.claimed[key] = true
+	return true, nil
+}
+
+// Release implements WebhookDeduper.
+func (d *FileDeduper) Release(ctx context.Context, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.claimed, key)
+	return nil
+}
+
+// Mark implements WebhookDeduper. The key is written to the file before
+// Mark returns. If it can't be written, the key stays claimed, so
+// duplicates are still dropped until the process exits.
+func (d *FileDeduper) Mark(ctx context.Context, key string) error {
+	if strings.ContainsAny(key, "\t\n") {
+		return fmt.Errorf("monzo: invalid dedupe key %q", key)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var expires time.Time
+	if d.ttl > 0 {
+		expires = d.now().Add(d.ttl)
+	}
+	if _, err := d.file.WriteString(dedupeLine(key, expires)); err != nil {
+		return fmt.Errorf("monzo: write dedupe file: %w", err)
+	}
+	if err := d.file.Sync(); err != nil {
+		return fmt.Errorf("monzo: write dedupe file: %w", err)
+	}
+	delete(d.claimed, key)
+	d.keys[key] = expires
+	d.lines++
+
+	if d.lines >= d.compactAt {
+		return d.recompact()
+	}
+	return nil
+}
+
+// Close closes the underlying file.
+func (d *FileDeduper) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.file.Close()
+}
@@ -0,0 +1,324 @@
+package monzo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDedupeKey(t *testing.T) {
+	event := func(body string) *WebhookEvent {
+		e, err := ParseWebhookEvent(newWebhookRequest(body))
+		if err != nil {
+			t.Fatalf("ParseWebhookEvent returned an error: %v", err)
+		}
+		return e
+	}
+
+	a := WebhookDedupeKey(event(`{"type": "transaction.created", "data": {"id": "tx_001", "amount": -350}}`))
+	b := WebhookDedupeKey(event(`{"type":"transaction.created","data":{"id":"tx_001","amount":-350}}`))
+	if a != b {
+		t.Errorf("expected whitespace not to change the key, got %s and %s", a, b)
+	}
+	if c := WebhookDedupeKey(event(`{"type": "transaction.updated", "data": {"id": "tx_001", "amount": -350}}`)); c == a {
+		t.Error("expected a different event type to change the key")
+	}
+	if d := WebhookDedupeKey(event(`{"type": "transaction.created", "data": {"id": "tx_001", "amount": -400}}`)); d == a {
+		t.Error("expected a different payload to change the key")
+	}
+}
+
+func TestMemoryDeduper(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := NewMemoryDeduper(2, time.Hour)
+	d.now = func() time.Time { return now }
+
+	for _, key := range []string{"a", "b"} {
+		if claimed, err := d.Claim(ctx, key); err != nil || !claimed {
+			t.Fatalf("expected to claim %s, got %v, %v", key, claimed, err)
+		}
+		if err := d.Mark(ctx, key); err != nil {
+			t.Fatalf("Mark returned an error: %v", err)
+		}
+	}
+	// Claiming "a" again makes "b" the least recently used.
+	if claimed, _ := d.Claim(ctx, "a"); claimed {
+		t.Error("expected a marked key not to be claimed")
+	}
+	d.Claim(ctx, "c")
+	d.Mark(ctx, "c")
+	if claimed, _ := d.Claim(ctx, "b"); !claimed {
+		t.Error("expected b to have been evicted")
+	}
+	d.Release(ctx, "b")
+	if d.Len() != 2 {
+		t.Errorf("expected 2 keys, got %d", d.Len())
+	}
+
+	now = now.Add(time.Hour)
+	if claimed, _ := d.Claim(ctx, "a"); !claimed {
+		t.Error("expected a to have expired")
+	}
+}
+
+// testDeduperClaims checks the claim behaviour every WebhookDeduper
+// shares.
+func testDeduperClaims(t *testing.T, d WebhookDeduper) {
+	t.Helper()
+	ctx := context.Background()
+
+	if claimed, err := d.Claim(ctx, "k"); err != nil || !claimed {
+		t.Fatalf("expected to claim k, got %v, %v", claimed, err)
+	}
+	if claimed, _ := d.Claim(ctx, "k"); claimed {
+		t.Error("expected a claimed key not to be claimed again")
+	}
+	d.Release(ctx, "k")
+	if claimed, _ := d.Claim(ctx, "k"); !claimed {
+		t.Error("expected a released key to be claimed again")
+	}
+	if err := d.Mark(ctx, "k"); err != nil {
+		t.Fatalf("Mark returned an error: %v", err)
+	}
+	if claimed, _ := d.Claim(ctx, "k"); claimed {
+		t.Error("expected a marked key not to be claimed")
+	}
+
+	// Only one of many concurrent claims wins.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	wins := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if claimed, _ := d.Claim(ctx, "race"); claimed {
+				mu.Lock()
+				wins++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if wins != 1 {
+		t.Errorf("expected exactly 1 claim to win, got %d", wins)
+	}
+}
+
+func TestDeduperClaims(t *testing.T) {
+	testDeduperClaims(t, NewMemoryDeduper(100, time.Hour))
+
+	d, err := NewFileDeduper(filepath.Join(t.TempDir(), "webhooks.dedupe"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileDeduper returned an error: %v", err)
+	}
+	defer d.Close()
+	testDeduperClaims(t, d)
+}
+
+func TestFileDeduper(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhooks.dedupe")
+
+	d, err := NewFileDeduper(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileDeduper returned an error: %v", err)
+	}
+	d.Claim(ctx, "transaction.created:tx_001:abc")
+	if err := d.Mark(ctx, "transaction.created:tx_001:abc"); err != nil {
+		t.Fatalf("Mark returned an error: %v", err)
+	}
+	if err := d.Mark(ctx, "bad\tkey"); err == nil {
+		t.Error("expected an error for a key containing a tab")
+	}
+	d.Close()
+
+	// Keys survive reopening the file...
+	d, err = NewFileDeduper(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileDeduper returned an error: %v", err)
+	}
+	if claimed, err := d.Claim(ctx, "transaction.created:tx_001:abc"); err != nil || claimed {
+		t.Errorf("expected key to be marked after reopening, got %v, %v", claimed, err)
+	}
+	d.Close()
+
+	// ...until they expire.
+	d = &FileDeduper{now: func() time.Time { return time.Now().Add(2 * time.Hour) }, keys: make(map[string]time.Time), claimed: make(map[string]bool)}
+	if err := d.load(path); err != nil {
+		t.Fatalf("load returned an error: %v", err)
+	}
+	if claimed, _ := d.Claim(ctx, "transaction.created:tx_001:abc"); !claimed {
+		t.Error("expected key to have expired")
+	}
+}
+
+func TestFileDeduper_Compacts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhooks.dedupe")
+	now := time.Now()
+
+	d, err := NewFileDeduper(path, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileDeduper returned an error: %v", err)
+	}
+	defer d.Close()
+	d.now = func() time.Time { return now }
+
+	// Mark keys for long enough that most of them expire.
+	for i := range 5 * fileDedupeCompactLines {
+		key := fmt.Sprintf("key_%d", i)
+		d.Claim(ctx, key)
+		if err := d.Mark(ctx, key); err != nil {
+			t.Fatalf("Mark returned an error: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile returned an error: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 2*fileDedupeCompactLines {
+		t.Errorf("expected the file to be compacted, got %d lines", lines)
+	}
+	// Recent keys are still recognised.
+	if claimed, _ := d.Claim(ctx, fmt.Sprintf("key_%d", 5*fileDedupeCompactLines-1)); claimed {
+		t.Error("expected the most recent key to still be marked")
+	}
+}
+
+func TestParseWebhookEvent_Deduper(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemoryDeduper(100, time.Hour)
+
+	event, err := ParseWebhookEvent(newWebhookRequest(txCreatedWebhook), WithWebhookDeduper(d))
+	if err != nil {
+		t.Fatalf("ParseWebhookEvent returned an error: %v", err)
+	}
+	// The event is claimed until it's marked or released.
+	if _, err := ParseWebhookEvent(newWebhookRequest(txCreatedWebhook), WithWebhookDeduper(d)); !errors.Is(err, ErrDuplicateWebhook) {
+		t.Errorf("expected ErrDuplicateWebhook while the event is claimed, got %v", err)
+	}
+	if err := event.Release(ctx); err != nil {
+		t.Fatalf("Release returned an error: %v", err)
+	}
+
+	event, err = ParseWebhookEvent(newWebhookRequest(txCreatedWebhook), WithWebhookDeduper(d))
+	if err != nil {
+		t.Fatalf("expected a released event to be parsed again, got %v", err)
+	}
+	if err := event.MarkHandled(ctx); err != nil {
+		t.Fatalf("MarkHandled returned an error: %v", err)
+	}
+	// Releasing after marking does nothing.
+	event.Release(ctx)
+	if _, err := ParseWebhookEvent(newWebhookRequest(txCreatedWebhook), WithWebhookDeduper(d)); !errors.Is(err, ErrDuplicateWebhook) {
+		t.Errorf("expected ErrDuplicateWebhook once the event is handled, got %v", err)
+	}
+
+	// Events parsed without a deduper have nothing to mark.
+	event, _ = ParseWebhookEvent(newWebhookRequest(txCreatedWebhook))
+	if err := event.MarkHandled(ctx); err != nil {
+		t.Errorf("expected MarkHandled to do nothing, got %v", err)
+	}
+
+	if _, err := ParseWebhookTransactionCreated(newWebhookRequest(txCreatedWebhook), WithWebhookDeduper(d)); err == nil {
+		t.Error("expected ParseWebhookTransactionCreated to reject WithWebhookDeduper")
+	}
+}
+
+func TestWebhookHandler_Deduper(t *testing.T) {
+	h := NewWebhookHandler(WithWebhookDeduper(NewMemoryDeduper(100, time.Hour)))
+
+	calls := 0
+	fail := true
+	h.OnTransactionCreated(func(ctx context.Context, tx *Transaction) error {
+		calls++
+		if fail {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	// A failed delivery isn't marked, so the redelivery is handled.
+	if code := serveWebhook(h, http.MethodPost, txCreatedWebhook); code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", code)
+	}
+	fail = false
+	if code := serveWebhook(h, http.MethodPost, txCreatedWebhook); code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+	// A successful delivery is, so later redeliveries are acknowledged
+	// without calling the callback.
+	if code := serveWebhook(h, http.MethodPost, txCreatedWebhook); code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 callback calls, got %d", calls)
+	}
+}
+
+func TestWebhookHandler_DeduperInFlight(t *testing.T) {
+	h := NewWebhookHandler(WithWebhookDeduper(NewMemoryDeduper(100, time.Hour)))
+
+	var calls atomic.Int32
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	h.OnTransactionCreated(func(ctx context.Context, tx *Transaction) error {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-finish
+		}
+		return nil
+	})
+
+	// Monzo redelivers while the first delivery is still being handled.
+	first := make(chan int)
+	go func() { first <- serveWebhook(h, http.MethodPost, txCreatedWebhook) }()
+	<-started
+	if code := serveWebhook(h, http.MethodPost, txCreatedWebhook); code != http.StatusOK {
+		t.Errorf("expected the redelivery to be acknowledged, got %d", code)
+	}
+	close(finish)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected the callback to run once, got %d", n)
+	}
+}
+
+func TestWebhookHandler_DeduperReleasesOnPanic(t *testing.T) {
+	h := NewWebhookHandler(
+		WithWebhookDeduper(NewMemoryDeduper(100, time.Hour)),
+		WithWebhookPanicPolicy(WebhookPanicRecoverRetry),
+	)
+	calls := 0
+	h.OnTransactionCreated(func(ctx context.Context, tx *Transaction) error {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		return nil
+	})
+
+	if code := serveWebhook(h, http.MethodPost, txCreatedWebhook); code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", code)
+	}
+	if code := serveWebhook(h, http.MethodPost, txCreatedWebhook); code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+	if calls != 2 {
+		t.Errorf("expected the retry after a panic to be handled, got %d calls", calls)
+	}
+}
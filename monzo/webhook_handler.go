@@ -0,0 +1,228 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ErrInvalidWebhook is reported by WebhookHandler for requests whose body
+// is not a valid webhook event, or whose payload doesn't match its type.
+var ErrInvalidWebhook = errors.New("monzo: invalid webhook")
+
+// WebhookPanicPolicy controls what a WebhookHandler does when one of its
+// callbacks panics.
+type WebhookPanicPolicy int
+
+const (
+	// WebhookPanicPropagate lets the panic continue up to net/http, which
+	// logs it and aborts the connection. Monzo will retry the webhook.
+	// This is the default.
+	WebhookPanicPropagate WebhookPanicPolicy = iota
+	// WebhookPanicRecoverAck recovers from the panic, reports it to the
+	// error handler and responds 200 OK, so Monzo won't retry.
+	WebhookPanicRecoverAck
+	// WebhookPanicRecoverRetry recovers from the panic, reports it to the
+	// error handler and responds 500, so Monzo will retry.
+	WebhookPanicRecoverRetry
+)
+
+// WithWebhookPanicPolicy sets what the handler does when a callback
+// panics. It defaults to WebhookPanicPropagate.
+func WithWebhookPanicPolicy(policy WebhookPanicPolicy) WebhookOption {
+	return func(cfg *webhookConfig) {
+		cfg.panicPolicy = policy
+	}
+}
+
+// WithWebhookErrorHandler registers a function that is called with every
+// error the handler encounters: invalid requests (wrapping
+// ErrInvalidWebhook), errors returned by callbacks, and recovered panics.
+// By default errors are not reported anywhere.
+func WithWebhookErrorHandler(fn func(r *http.Request, err error)) WebhookOption {
+	return func(cfg *webhookConfig) {
+		cfg.errorHandler = fn
+	}
+}
+
+// WebhookHandler is an http.Handler that receives Monzo webhooks and
+// dispatches them to callbacks registered by event type.
+//
+// It responds with the status Monzo expects:
+//   - 405 for methods other than POST, and 413 for oversized bodies.
+//   - 403 for requests without the secret set by WithWebhookSecret, and
+//     for events that WithTransactionConfirmation couldn't confirm.
+//   - 200 for events that are invalid or have no callback, as retrying
+//     them would not help.
+//   - 500 if a callback returns an error, so Monzo retries the webhook.
+//   - 200 once every callback for the event has succeeded.
+//   - 200 for duplicates, and for redeliveries of events still being
+//     handled, if WithWebhookDeduper is set.
+//
+// Callbacks may be registered while the handler is serving requests.
+type WebhookHandler struct {
+	cfg *webhookConfig
+
+	mu       sync.RWMutex
+	handlers map[WebhookEventType][]func(context.Context, *WebhookEvent) error
+}
+
+// NewWebhookHandler creates a WebhookHandler with no callbacks registered.
+func NewWebhookHandler(opts ...WebhookOption) *WebhookHandler {
+	return &WebhookHandler{
+		cfg:      newWebhookConfig(opts),
+		handlers: make(map[WebhookEventType][]func(context.Context, *WebhookEvent) error),
+	}
+}
+
+// On registers fn to be called for every event of the given type. If more
+// than one callback is registered for a type, they are called in the order
+// they were registered, stopping at the first error.
+func (h *WebhookHandler) On(eventType WebhookEventType, fn func(ctx context.Context, event *WebhookEvent) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[eventType] = append(h.handlers[eventType], fn)
+}
+
+// OnTransactionCreated registers fn to be called with the transaction from
+// every transaction.created event.
+func (h *WebhookHandler) OnTransactionCreated(fn func(ctx context.Context, tx *Transaction) error) {
+	h.On(WebhookTransactionCreated, transactionCallback(fn))
+}
+
+// OnTransactionUpdated registers fn to be called with the transaction from
+// every transaction.updated event.
+func (h *WebhookHandler) OnTransactionUpdated(fn func(ctx context.Context, tx *Transaction) error) {
+	h.On(WebhookTransactionUpdated, transactionCallback(fn))
+}
+
+// transactionCallback adapts a transaction callback to an event callback.
+// Payloads that don't decode are reported as ErrInvalidWebhook.
+func transactionCallback(fn func(context.Context, *Transaction) error) func(context.Context, *WebhookEvent) error {
+	return func(ctx context.Context, event *WebhookEvent) error {
+		tx, err := event.Transaction()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidWebhook, err)
+		}
+		return fn(ctx, tx)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.reportError(r, fmt.Errorf("%w: method %s not allowed", ErrInvalidWebhook, r.Method))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.cfg.checkSecret {
+		if err := VerifyWebhookSecret(r, h.cfg.secret); err != nil {
+			h.reportError(r, err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	event, err := parseWebhookEvent(w, r, h.cfg)
+	if err != nil {
+		h.reportError(r, fmt.Errorf("%w: %w", ErrInvalidWebhook, err))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// handled is set once every callback has succeeded. Until then the
+	// claim on the event is released when ServeHTTP returns, so Monzo's
+	// retry will be handled.
+	var handled bool
+	if h.cfg.deduper != nil {
+		dedupeKey := WebhookDedupeKey(event)
+		claimed, err := h.cfg.deduper.Claim(r.Context(), dedupeKey)
+		if err != nil {
+			h.reportError(r, fmt.Errorf("monzo: claim webhook: %w", err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			// A duplicate, or a redelivery of an event still being
+			// handled.
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		defer func() {
+			if handled {
+				// The event has been handled, so acknowledge it even if
+				// it can't be marked; a retry would only run the
+				// callbacks again.
+				if err := h.cfg.deduper.Mark(r.Context(), dedupeKey); err != nil {
+					h.reportError(r, fmt.Errorf("monzo: mark webhook: %w", err))
+				}
+				return
+			}
+			if err := h.cfg.deduper.Release(r.Context(), dedupeKey); err != nil {
+				h.reportError(r, fmt.Errorf("monzo: release webhook: %w", err))
+			}
+		}()
+	}
+
+	if err := confirmWebhookEvent(r.Context(), h.cfg, event); err != nil {
+		h.reportError(r, err)
+		switch {
+		case errors.Is(err, ErrWebhookUnconfirmed):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, ErrInvalidWebhook):
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.mu.RLock()
+	callbacks := h.handlers[event.Type]
+	h.mu.RUnlock()
+
+	if h.cfg.panicPolicy != WebhookPanicPropagate {
+		defer func() {
+			if v := recover(); v != nil {
+				h.reportError(r, fmt.Errorf("monzo: panic handling %s webhook: %v", event.Type, v))
+				if h.cfg.panicPolicy == WebhookPanicRecoverAck {
+					w.WriteHeader(http.StatusOK)
+				} else {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}
+		}()
+	}
+
+	for _, fn := range callbacks {
+		if err := fn(r.Context(), event); err != nil {
+			h.reportError(r, err)
+			if errors.Is(err, ErrInvalidWebhook) {
+				w.WriteHeader(http.StatusOK)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	handled = true
+	w.WriteHeader(http.StatusOK)
+}
+
+// reportError passes err to the configured error handler, if any.
+func (h *WebhookHandler) reportError(r *http.Request, err error) {
+	if h.cfg.errorHandler != nil {
+		h.cfg.errorHandler(r, err)
+	}
+}
@@ -0,0 +1,141 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const txCreatedWebhook = `{"type": "transaction.created", "data": {"id": "tx_001", "account_id": "acc_001", "amount": -350, "currency": "GBP"}}`
+
+func serveWebhook(h http.Handler, method, body string) int {
+	req := httptest.NewRequest(method, "/webhook", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebhookHandler_Dispatch(t *testing.T) {
+	h := NewWebhookHandler()
+
+	var created, updated []string
+	h.OnTransactionCreated(func(ctx context.Context, tx *Transaction) error {
+		created = append(created, tx.ID)
+		return nil
+	})
+	h.OnTransactionUpdated(func(ctx context.Context, tx *Transaction) error {
+		updated = append(updated, tx.ID)
+		return nil
+	})
+
+	if code := serveWebhook(h, http.MethodPost, txCreatedWebhook); code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+	if code := serveWebhook(h, http.MethodPost, `{"type": "transaction.updated", "data": {"id": "tx_002"}}`); code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+	// Events without a callback are acknowledged.
+	if code := serveWebhook(h, http.MethodPost, `{"type": "account.updated", "data": {}}`); code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+
+	if len(created) != 1 || created[0] != "tx_001" {
+		t.Errorf("expected created [tx_001], got %v", created)
+	}
+	if len(updated) != 1 || updated[0] != "tx_002" {
+		t.Errorf("expected updated [tx_002], got %v", updated)
+	}
+}
+
+func TestWebhookHandler_Statuses(t *testing.T) {
+	var reported []error
+	h := NewWebhookHandler(
+		WithWebhookMaxBodyBytes(256),
+		WithWebhookErrorHandler(func(r *http.Request, err error) {
+			reported = append(reported, err)
+		}),
+	)
+	callbackErr := errors.New("database unavailable")
+	h.On(WebhookTransactionCreated, func(ctx context.Context, event *WebhookEvent) error {
+		return callbackErr
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"too large", http.MethodPost, `{"type": "transaction.created", "data": {"description": "` + strings.Repeat("x", 512) + `"}}`, http.StatusRequestEntityTooLarge},
+		{"malformed", http.MethodPost, `{invalid`, http.StatusOK},
+		{"callback error", http.MethodPost, txCreatedWebhook, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		reported = nil
+		if code := serveWebhook(h, tt.method, tt.body); code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, code)
+		}
+		if len(reported) != 1 {
+			t.Errorf("%s: expected 1 reported error, got %d", tt.name, len(reported))
+		}
+	}
+	if !errors.Is(reported[0], callbackErr) {
+		t.Errorf("expected callback error to be reported, got %v", reported[0])
+	}
+}
+
+func TestWebhookHandler_InvalidPayload(t *testing.T) {
+	var reported error
+	h := NewWebhookHandler(WithWebhookErrorHandler(func(r *http.Request, err error) { reported = err }))
+	h.OnTransactionCreated(func(ctx context.Context, tx *Transaction) error {
+		t.Error("callback should not be called for an invalid payload")
+		return nil
+	})
+
+	if code := serveWebhook(h, http.MethodPost, `{"type": "transaction.created", "data": {"amount": "lots"}}`); code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+	if !errors.Is(reported, ErrInvalidWebhook) {
+		t.Errorf("expected ErrInvalidWebhook, got %v", reported)
+	}
+}
+
+func TestWebhookHandler_PanicPolicy(t *testing.T) {
+	panicky := func(ctx context.Context, tx *Transaction) error { panic("boom") }
+
+	tests := []struct {
+		policy WebhookPanicPolicy
+		want   int
+	}{
+		{WebhookPanicRecoverAck, http.StatusOK},
+		{WebhookPanicRecoverRetry, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		var reported error
+		h := NewWebhookHandler(
+			WithWebhookPanicPolicy(tt.policy),
+			WithWebhookErrorHandler(func(r *http.Request, err error) { reported = err }),
+		)
+		h.OnTransactionCreated(panicky)
+
+		if code := serveWebhook(h, http.MethodPost, txCreatedWebhook); code != tt.want {
+			t.Errorf("policy %d: expected status %d, got %d", tt.policy, tt.want, code)
+		}
+		if reported == nil || !strings.Contains(reported.Error(), "boom") {
+			t.Errorf("policy %d: expected panic to be reported, got %v", tt.policy, reported)
+		}
+	}
+
+	h := NewWebhookHandler()
+	h.OnTransactionCreated(panicky)
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic to propagate by default")
+		}
+	}()
+	serveWebhook(h, http.MethodPost, txCreatedWebhook)
+}
@@ -0,0 +1,181 @@
+package monzo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Monzo doesn't sign webhooks, so anyone who learns a webhook's URL can
+// send forged events to it. The helpers in this file guard against that
+// by registering webhooks with a random secret in their URL, and checking
+// for it on every request. Confirming events with GetTransaction, using
+// WithTransactionConfirmation, additionally protects against a leaked
+// secret.
+
+// WebhookSecretParam is the query parameter that holds the secret in URLs
+// built by WebhookURLWithSecret.
+const WebhookSecretParam = "monzo_secret"
+
+var (
+	// ErrWebhookSecretMismatch is returned when a webhook request doesn't
+	// carry the expected secret.
+	ErrWebhookSecretMismatch = errors.New("monzo: webhook secret mismatch")
+	// ErrWebhookUnconfirmed is returned when a transaction event can't be
+	// confirmed with the API, because the transaction doesn't exist or
+	// doesn't match the event.
+	ErrWebhookUnconfirmed = errors.New("monzo: webhook not confirmed by the API")
+)
+
+// NewWebhookSecret returns a new random secret, suitable for
+// WebhookURLWithSecret.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("monzo: generate webhook secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// WebhookURLWithSecret returns webhookURL with secret added as the
+// WebhookSecretParam query parameter.
+func WebhookURLWithSecret(webhookURL, secret string) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("monzo: invalid webhook URL: %w", err)
+	}
+	query := u.Query()
+	query.Set(WebhookSecretParam, secret)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// redactWebhookURL returns webhookURL with the value of its
+// WebhookSecretParam query parameter replaced, so it can be logged.
+func redactWebhookURL(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	query := u.Query()
+	if !query.Has(WebhookSecretParam) {
+		return webhookURL
+	}
+	query.Set(WebhookSecretParam, "REDACTED")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// RegisterWebhookWithSecret registers a webhook like RegisterWebhook, with
+// a new random secret embedded in its URL. It returns the webhook and the
+// secret, which should be stored and passed to WithWebhookSecret or
+// VerifyWebhookSecret on the receiving side.
+//
+// As every call makes a new secret, it registers a new webhook every time.
+// To register on every deploy, store the secret and use
+// EnsureWebhookWithSecret or SyncWebhooksOptions.Secret instead.
+func (c *Client) RegisterWebhookWithSecret(ctx context.Context, accountID, webhookURL string) (*Webhook, string, error) {
+	secret, err := NewWebhookSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	secretURL, err := WebhookURLWithSecret(webhookURL, secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	webhook, err := c.RegisterWebhook(ctx, accountID, secretURL)
+	if err != nil {
+		return nil, "", err
+	}
+	return webhook, secret, nil
+}
+
+// VerifyWebhookSecret checks that r carries secret in its
+// WebhookSecretParam query parameter, in constant time. It returns
+// ErrWebhookSecretMismatch if it doesn't, or if secret is empty.
+func VerifyWebhookSecret(r *http.Request, secret string) error {
+	got := r.URL.Query().Get(WebhookSecretParam)
+	if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+		return ErrWebhookSecretMismatch
+	}
+	return nil
+}
+
+// WithWebhookSecret rejects webhook requests that don't carry secret, as
+// registered by RegisterWebhookWithSecret. ParseWebhookEvent returns
+// ErrWebhookSecretMismatch for them, and WebhookHandler responds 403.
+func WithWebhookSecret(secret string) WebhookOption {
+	return func(cfg *webhookConfig) {
+		cfg.secret = secret
+		cfg.checkSecret = true
+	}
+}
+
+// WithTransactionConfirmation confirms every transaction event by fetching
+// the transaction with client.GetTransaction, and checking that its
+// account and currency match the event. The event's Data is then replaced
+// with the transaction from the API, so callbacks never see a forged
+// amount, description or merchant. The amount isn't compared, as it
+// legitimately changes after the event, e.g. when a card payment is
+// captured or settled in a foreign currency. Events that don't match,
+// or whose transaction doesn't exist, are rejected with
+// ErrWebhookUnconfirmed; WebhookHandler responds 403 to them. If the API
+// can't be reached, WebhookHandler responds 500 so Monzo retries later.
+//
+// The client must be authorised for the accounts the webhooks are for.
+func WithTransactionConfirmation(client *Client) WebhookOption {
+	return func(cfg *webhookConfig) {
+		cfg.confirmClient = client
+	}
+}
+
+// confirmWebhookEvent confirms event with the API if cfg asks for it,
+// replacing its Data with the transaction the API returns. Events that
+// don't carry a transaction are not checked.
+func confirmWebhookEvent(ctx context.Context, cfg *webhookConfig, event *WebhookEvent) error {
+	if cfg.confirmClient == nil {
+		return nil
+	}
+	newPayload, ok := lookupWebhookEventType(event.Type)
+	if !ok {
+		return nil
+	}
+	if _, isTx := newPayload().(*Transaction); !isTx {
+		return nil
+	}
+
+	tx, err := event.Transaction()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWebhook, err)
+	}
+	if tx.ID == "" {
+		return fmt.Errorf("%w: %s event has no transaction ID", ErrWebhookUnconfirmed, event.Type)
+	}
+
+	// Webhooks carry the merchant expanded, so fetch it the same way.
+	actual, err := cfg.confirmClient.GetTransaction(ctx, tx.ID, true)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: transaction %s: %w", ErrWebhookUnconfirmed, tx.ID, err)
+	}
+	if err != nil {
+		return fmt.Errorf("monzo: confirm transaction %s: %w", tx.ID, err)
+	}
+
+	if actual.ID != tx.ID || actual.AccountID != tx.AccountID || actual.Currency != tx.Currency {
+		return fmt.Errorf("%w: transaction %s doesn't match the event", ErrWebhookUnconfirmed, tx.ID)
+	}
+
+	data, err := json.Marshal(actual)
+	if err != nil {
+		return fmt.Errorf("monzo: confirm transaction %s: %w", tx.ID, err)
+	}
+	event.Data = data
+	return nil
+}
@@ -0,0 +1,185 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWebhookURLWithSecret(t *testing.T) {
+	secret, err := NewWebhookSecret()
+	if err != nil {
+		t.Fatalf("NewWebhookSecret returned an error: %v", err)
+	}
+	if len(secret) < 40 {
+		t.Errorf("expected a long secret, got %q", secret)
+	}
+
+	got, err := WebhookURLWithSecret("https://example.com/monzo?env=prod", secret)
+	if err != nil {
+		t.Fatalf("WebhookURLWithSecret returned an error: %v", err)
+	}
+	u, _ := url.Parse(got)
+	if u.Query().Get(WebhookSecretParam) != secret || u.Query().Get("env") != "prod" {
+		t.Errorf("unexpected URL %s", got)
+	}
+}
+
+func TestRegisterWebhookWithSecret(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	mux.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		fmt.Fprintf(w, `{"webhook": {"id": "webhook_001", "account_id": %q, "url": %q}}`, r.Form.Get("account_id"), r.Form.Get("url"))
+	})
+
+	webhook, secret, err := client.RegisterWebhookWithSecret(context.Background(), "acc_001", "https://example.com/monzo")
+	if err != nil {
+		t.Fatalf("RegisterWebhookWithSecret returned an error: %v", err)
+	}
+	if !strings.HasPrefix(webhook.URL, "https://example.com/monzo?"+WebhookSecretParam+"=") {
+		t.Errorf("expected registered URL to carry the secret, got %s", webhook.URL)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, webhook.URL, strings.NewReader(txCreatedWebhook))
+	if err := VerifyWebhookSecret(req, secret); err != nil {
+		t.Errorf("VerifyWebhookSecret returned an error: %v", err)
+	}
+}
+
+func TestVerifyWebhookSecret(t *testing.T) {
+	tests := []struct {
+		target string
+		secret string
+		want   error
+	}{
+		{"/webhook?monzo_secret=s3cret", "s3cret", nil},
+		{"/webhook?monzo_secret=guess", "s3cret", ErrWebhookSecretMismatch},
+		{"/webhook", "s3cret", ErrWebhookSecretMismatch},
+		{"/webhook", "", ErrWebhookSecretMismatch},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+		if err := VerifyWebhookSecret(req, tt.secret); !errors.Is(err, tt.want) {
+			t.Errorf("VerifyWebhookSecret(%s, %q) = %v, want %v", tt.target, tt.secret, err, tt.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook?monzo_secret=guess", strings.NewReader(txCreatedWebhook))
+	if _, err := ParseWebhookEvent(req, WithWebhookSecret("s3cret")); !errors.Is(err, ErrWebhookSecretMismatch) {
+		t.Errorf("expected ErrWebhookSecretMismatch, got %v", err)
+	}
+
+	h := NewWebhookHandler(WithWebhookSecret("s3cret"))
+	for target, want := range map[string]int{
+		"/webhook?monzo_secret=guess":  http.StatusForbidden,
+		"/webhook?monzo_secret=s3cret": http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(txCreatedWebhook)))
+		if rec.Code != want {
+			t.Errorf("%s: expected status %d, got %d", target, want, rec.Code)
+		}
+	}
+}
+
+func TestWithTransactionConfirmation(t *testing.T) {
+	client, mux, teardown := setup(t, WithRetryPolicy(NoRetries))
+	defer teardown()
+
+	mux.HandleFunc("/transactions/tx_001", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"transaction": {"id": "tx_001", "account_id": "acc_001", "amount": -350, "currency": "GBP"}}`)
+	})
+	mux.HandleFunc("/transactions/tx_404", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code": "not_found", "message": "Transaction not found"}`)
+	})
+	mux.HandleFunc("/transactions/tx_500", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	calls := 0
+	h := NewWebhookHandler(WithTransactionConfirmation(client))
+	h.OnTransactionCreated(func(ctx context.Context, tx *Transaction) error {
+		calls++
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+		want    int
+	}{
+		{"genuine", txCreatedWebhook, nil, http.StatusOK},
+		{"amount since captured", `{"type": "transaction.updated", "data": {"id": "tx_001", "account_id": "acc_001", "amount": -300, "currency": "GBP"}}`, nil, http.StatusOK},
+		{"forged account", `{"type": "transaction.created", "data": {"id": "tx_001", "account_id": "acc_999", "amount": -350, "currency": "GBP"}}`, ErrWebhookUnconfirmed, http.StatusForbidden},
+		{"forged currency", `{"type": "transaction.created", "data": {"id": "tx_001", "account_id": "acc_001", "amount": -350, "currency": "USD"}}`, ErrWebhookUnconfirmed, http.StatusForbidden},
+		{"unknown transaction", `{"type": "transaction.created", "data": {"id": "tx_404", "account_id": "acc_001", "amount": -350, "currency": "GBP"}}`, ErrWebhookUnconfirmed, http.StatusForbidden},
+		{"API unavailable", `{"type": "transaction.created", "data": {"id": "tx_500", "account_id": "acc_001", "amount": -350, "currency": "GBP"}}`, ErrServerError, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		_, err := ParseWebhookEvent(newWebhookRequest(tt.body), WithTransactionConfirmation(client))
+		if !errors.Is(err, tt.wantErr) && !(tt.wantErr == nil && err == nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if code := serveWebhook(h, http.MethodPost, tt.body); code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, code)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the callback to be called once, got %d", calls)
+	}
+}
+
+func TestWithTransactionConfirmation_ForgedPayload(t *testing.T) {
+	client, mux, teardown := setup(t, WithRetryPolicy(NoRetries))
+	defer teardown()
+
+	mux.HandleFunc("/transactions/tx_001", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("expand[]") != "merchant" {
+			t.Errorf("expected the merchant to be expanded, got %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"transaction": {"id": "tx_001", "account_id": "acc_001", "amount": -350, "currency": "GBP", "description": "PRET A MANGER", "merchant": {"id": "merch_001", "name": "Pret A Manger"}}}`)
+	})
+
+	// The ID is real, but everything else about the event is forged.
+	forged := `{"type": "transaction.created", "data": {"id": "tx_001", "account_id": "acc_001", "amount": -99999999, "currency": "GBP", "description": "FORGED", "merchant": {"id": "merch_666", "name": "Forged"}}}`
+
+	var got *Transaction
+	h := NewWebhookHandler(WithTransactionConfirmation(client))
+	h.OnTransactionCreated(func(ctx context.Context, tx *Transaction) error {
+		got = tx
+		return nil
+	})
+	if code := serveWebhook(h, http.MethodPost, forged); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if got == nil {
+		t.Fatal("expected the callback to be called")
+	}
+	if got.Amount != -350 || got.Description != "PRET A MANGER" {
+		t.Errorf("expected the transaction from the API, got %d %q", got.Amount, got.Description)
+	}
+	if m, ok := got.ExpandedMerchant(); !ok || m.ID != "merch_001" {
+		t.Errorf("expected the merchant from the API, got %s", got.Merchant)
+	}
+
+	event, err := ParseWebhookEvent(newWebhookRequest(forged), WithTransactionConfirmation(client))
+	if err != nil {
+		t.Fatalf("ParseWebhookEvent returned an error: %v", err)
+	}
+	tx, err := event.Transaction()
+	if err != nil {
+		t.Fatalf("Transaction returned an error: %v", err)
+	}
+	if tx.Amount != -350 || tx.Description != "PRET A MANGER" {
+		t.Errorf("expected the transaction from the API, got %d %q", tx.Amount, tx.Description)
+	}
+}
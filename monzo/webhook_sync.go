@@ -0,0 +1,163 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EnsureWebhook returns the account's webhook for webhookURL, registering
+// it only if there isn't one already. Unlike RegisterWebhook it can be
+// called on every deploy without creating duplicates.
+func (c *Client) EnsureWebhook(ctx context.Context, accountID, webhookURL string) (*Webhook, error) {
+	webhooks, err := c.ListWebhooks(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		if webhook.URL == webhookURL {
+			return &webhook, nil
+		}
+	}
+	return c.RegisterWebhook(ctx, accountID, webhookURL)
+}
+
+// EnsureWebhookWithSecret is like EnsureWebhook, for webhookURL with
+// secret added as by WebhookURLWithSecret. Pass the same secret on every
+// call, e.g. from your deployment's configuration, to reuse the webhook;
+// pass a new one to register a webhook with it alongside the old one.
+func (c *Client) EnsureWebhookWithSecret(ctx context.Context, accountID, webhookURL, secret string) (*Webhook, error) {
+	if secret == "" {
+		return nil, errors.New("monzo: empty webhook secret")
+	}
+	secretURL, err := WebhookURLWithSecret(webhookURL, secret)
+	if err != nil {
+		return nil, err
+	}
+	return c.EnsureWebhook(ctx, accountID, secretURL)
+}
+
+// SyncWebhooksOptions configures SyncWebhooks.
+type SyncWebhooksOptions struct {
+	// DryRun reports the changes SyncWebhooks would make without making
+	// them.
+	DryRun bool
+	// Secret, if set, is added to every desired URL as by
+	// WebhookURLWithSecret. Webhooks with any other secret are replaced,
+	// so changing it rotates the secret.
+	Secret string
+}
+
+// SyncWebhooksResult describes the changes made by SyncWebhooks, or that
+// would be made in a dry run.
+type SyncWebhooksResult struct {
+	// Added lists the webhooks registered. In a dry run only their
+	// AccountID and URL are set.
+	Added []Webhook
+	// Removed lists the webhooks deleted, because their URL isn't wanted
+	// or is a duplicate.
+	Removed []Webhook
+	// Kept lists the webhooks left as they were.
+	Kept []Webhook
+	// DryRun is set if no changes were actually made.
+	DryRun bool
+}
+
+// Changed reports whether any webhooks were, or would be, added or removed.
+func (r *SyncWebhooksResult) Changed() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0
+}
+
+// String formats the result as a diff, with one webhook URL per line
+// prefixed by "+" if added, "-" if removed or " " if kept. Webhook
+// secrets are redacted, so the diff can be logged.
+func (r *SyncWebhooksResult) String() string {
+	var b strings.Builder
+	for _, webhook := range r.Kept {
+		fmt.Fprintf(&b, "  %s\n", redactWebhookURL(webhook.URL))
+	}
+	for _, webhook := range r.Removed {
+		fmt.Fprintf(&b, "- %s (%s)\n", redactWebhookURL(webhook.URL), webhook.ID)
+	}
+	for _, webhook := range r.Added {
+		fmt.Fprintf(&b, "+ %s\n", redactWebhookURL(webhook.URL))
+	}
+	return b.String()
+}
+
+// SyncWebhooks makes the account's webhooks match desiredURLs: it
+// registers webhooks for URLs that are missing, and deletes webhooks whose
+// URLs aren't wanted, along with any duplicates. URLs are compared
+// exactly.
+//
+// New webhooks are registered before stale ones are deleted, so events
+// aren't missed while switching URLs. If a call fails, SyncWebhooks stops
+// and returns the changes made so far along with the error.
+func (c *Client) SyncWebhooks(ctx context.Context, accountID string, desiredURLs []string, options *SyncWebhooksOptions) (*SyncWebhooksResult, error) {
+	if options == nil {
+		options = &SyncWebhooksOptions{}
+	}
+
+	webhooks, err := c.ListWebhooks(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Secret != "" {
+		secretURLs := make([]string, len(desiredURLs))
+		for i, u := range desiredURLs {
+			secretURL, err := WebhookURLWithSecret(u, options.Secret)
+			if err != nil {
+				return nil, err
+			}
+			secretURLs[i] = secretURL
+		}
+		desiredURLs = secretURLs
+	}
+
+	desired := make(map[string]bool, len(desiredURLs))
+	for _, u := range desiredURLs {
+		desired[u] = true
+	}
+
+	result := &SyncWebhooksResult{DryRun: options.DryRun}
+	existing := make(map[string]bool, len(webhooks))
+	var stale []Webhook
+	for _, webhook := range webhooks {
+		if desired[webhook.URL] && !existing[webhook.URL] {
+			existing[webhook.URL] = true
+			result.Kept = append(result.Kept, webhook)
+			continue
+		}
+		stale = append(stale, webhook)
+	}
+
+	for _, u := range desiredURLs {
+		if existing[u] {
+			continue
+		}
+		existing[u] = true
+
+		if options.DryRun {
+			result.Added = append(result.Added, Webhook{AccountID: accountID, URL: u})
+			continue
+		}
+		webhook, err := c.RegisterWebhook(ctx, accountID, u)
+		if err != nil {
+			return result, fmt.Errorf("monzo: register webhook %s: %w", redactWebhookURL(u), err)
+		}
+		result.Added = append(result.Added, *webhook)
+	}
+
+	for _, webhook := range stale {
+		if !options.DryRun {
+			if err := c.DeleteWebhook(ctx, webhook.ID); err != nil {
+				return result, fmt.Errorf("monzo: delete webhook %s: %w", webhook.ID, err)
+			}
+		}
+		result.Removed = append(result.Removed, webhook)
+	}
+
+	return result, nil
+}
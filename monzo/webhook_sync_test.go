@@ -0,0 +1,176 @@
+package monzo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeWebhooks serves /webhooks from an in-memory list.
+func fakeWebhooks(t *testing.T, mux *http.ServeMux, webhooks *[]Webhook) {
+	next := 100
+	mux.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(ListWebhooksResponse{Webhooks: *webhooks})
+		case http.MethodPost:
+			r.ParseForm()
+			next++
+			webhook := Webhook{ID: fmt.Sprintf("webhook_%d", next), AccountID: r.Form.Get("account_id"), URL: r.Form.Get("url")}
+			*webhooks = append(*webhooks, webhook)
+			json.NewEncoder(w).Encode(RegisterWebhookResponse{Webhook: webhook})
+		}
+	})
+	mux.HandleFunc("/webhooks/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("expected DELETE, got %s", r.Method)
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/webhooks/")
+		for i, webhook := range *webhooks {
+			if webhook.ID == id {
+				*webhooks = append((*webhooks)[:i], (*webhooks)[i+1:]...)
+				break
+			}
+		}
+		fmt.Fprint(w, `{}`)
+	})
+}
+
+func TestEnsureWebhook(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	webhooks := []Webhook{{ID: "webhook_001", AccountID: "acc_001", URL: "https://example.com/a"}}
+	fakeWebhooks(t, mux, &webhooks)
+
+	got, err := client.EnsureWebhook(context.Background(), "acc_001", "https://example.com/a")
+	if err != nil {
+		t.Fatalf("EnsureWebhook returned an error: %v", err)
+	}
+	if got.ID != "webhook_001" || len(webhooks) != 1 {
+		t.Errorf("expected existing webhook_001 to be returned, got %s (%d webhooks)", got.ID, len(webhooks))
+	}
+
+	got, err = client.EnsureWebhook(context.Background(), "acc_001", "https://example.com/b")
+	if err != nil {
+		t.Fatalf("EnsureWebhook returned an error: %v", err)
+	}
+	if got.URL != "https://example.com/b" || len(webhooks) != 2 {
+		t.Errorf("expected a new webhook to be registered, got %+v (%d webhooks)", got, len(webhooks))
+	}
+}
+
+func TestSyncWebhooks(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	webhooks := []Webhook{
+		{ID: "webhook_001", AccountID: "acc_001", URL: "https://example.com/keep"},
+		{ID: "webhook_002", AccountID: "acc_001", URL: "https://example.com/old"},
+		{ID: "webhook_003", AccountID: "acc_001", URL: "https://example.com/keep"},
+	}
+	fakeWebhooks(t, mux, &webhooks)
+	desired := []string{"https://example.com/keep", "https://example.com/new"}
+
+	preview, err := client.SyncWebhooks(context.Background(), "acc_001", desired, &SyncWebhooksOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("SyncWebhooks returned an error: %v", err)
+	}
+	if len(webhooks) != 3 {
+		t.Errorf("expected a dry run to make no changes, got %d webhooks", len(webhooks))
+	}
+	want := "  https://example.com/keep\n" +
+		"- https://example.com/old (webhook_002)\n" +
+		"- https://example.com/keep (webhook_003)\n" +
+		"+ https://example.com/new\n"
+	if preview.String() != want || !preview.Changed() || !preview.DryRun {
+		t.Errorf("unexpected dry run result:\n%s", preview)
+	}
+
+	result, err := client.SyncWebhooks(context.Background(), "acc_001", desired, nil)
+	if err != nil {
+		t.Fatalf("SyncWebhooks returned an error: %v", err)
+	}
+	if len(result.Added) != 1 || result.Added[0].ID == "" || len(result.Removed) != 2 || len(result.Kept) != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(webhooks) != 2 || webhooks[0].ID != "webhook_001" || webhooks[1].URL != "https://example.com/new" {
+		t.Errorf("unexpected webhooks after sync: %+v", webhooks)
+	}
+
+	result, err = client.SyncWebhooks(context.Background(), "acc_001", desired, nil)
+	if err != nil {
+		t.Fatalf("SyncWebhooks returned an error: %v", err)
+	}
+	if result.Changed() {
+		t.Errorf("expected a second sync to change nothing, got:\n%s", result)
+	}
+}
+
+func TestSyncWebhooksSecret(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	webhooks := []Webhook{{ID: "webhook_001", AccountID: "acc_001", URL: "https://example.com/hook"}}
+	fakeWebhooks(t, mux, &webhooks)
+	desired := []string{"https://example.com/hook"}
+
+	preview, err := client.SyncWebhooks(context.Background(), "acc_001", desired, &SyncWebhooksOptions{DryRun: true, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("SyncWebhooks returned an error: %v", err)
+	}
+	want := "- https://example.com/hook (webhook_001)\n" +
+		"+ https://example.com/hook?monzo_secret=REDACTED\n"
+	if preview.String() != want {
+		t.Errorf("expected the secret to be redacted, got:\n%s", preview)
+	}
+
+	// Syncing with the same secret on every deploy doesn't add webhooks.
+	for range 2 {
+		if _, err := client.SyncWebhooks(context.Background(), "acc_001", desired, &SyncWebhooksOptions{Secret: "s3cret"}); err != nil {
+			t.Fatalf("SyncWebhooks returned an error: %v", err)
+		}
+	}
+	if len(webhooks) != 1 || webhooks[0].URL != "https://example.com/hook?monzo_secret=s3cret" {
+		t.Errorf("expected a single webhook with the secret, got %+v", webhooks)
+	}
+
+	// A new secret replaces the webhook.
+	result, err := client.SyncWebhooks(context.Background(), "acc_001", desired, &SyncWebhooksOptions{Secret: "rotated"})
+	if err != nil {
+		t.Fatalf("SyncWebhooks returned an error: %v", err)
+	}
+	if strings.Contains(result.String(), "s3cret") || strings.Contains(result.String(), "rotated") {
+		t.Errorf("expected secrets to be redacted, got:\n%s", result)
+	}
+	if len(webhooks) != 1 || webhooks[0].URL != "https://example.com/hook?monzo_secret=rotated" {
+		t.Errorf("expected the webhook to be replaced, got %+v", webhooks)
+	}
+}
+
+func TestEnsureWebhookWithSecret(t *testing.T) {
+	client, mux, teardown := setup(t)
+	defer teardown()
+
+	var webhooks []Webhook
+	fakeWebhooks(t, mux, &webhooks)
+
+	for range 2 {
+		got, err := client.EnsureWebhookWithSecret(context.Background(), "acc_001", "https://example.com/hook", "s3cret")
+		if err != nil {
+			t.Fatalf("EnsureWebhookWithSecret returned an error: %v", err)
+		}
+		if got.URL != "https://example.com/hook?monzo_secret=s3cret" {
+			t.Errorf("unexpected URL %s", got.URL)
+		}
+	}
+	if len(webhooks) != 1 {
+		t.Errorf("expected 1 webhook, got %d", len(webhooks))
+	}
+	if _, err := client.EnsureWebhookWithSecret(context.Background(), "acc_001", "https://example.com/hook", ""); err == nil {
+		t.Error("expected an error for an empty secret")
+	}
+}
@@ -0,0 +1,192 @@
+package monzo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newWebhookRequest(body string) *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+}
+
+func TestParseWebhookEvent_TransactionUpdated(t *testing.T) {
+	req := newWebhookRequest(`{
+		"type": "transaction.updated",
+		"data": {
+			"id": "tx_001",
+			"account_id": "acc_001",
+			"amount": -350,
+			"currency": "GBP",
+			"settled": "2025-01-02T10:00:00Z",
+			"notes": "coffee"
+		}
+	}`)
+
+	event, err := ParseWebhookEvent(req)
+	if err != nil {
+		t.Fatalf("ParseWebhookEvent returned an error: %v", err)
+	}
+	if event.Type != WebhookTransactionUpdated {
+		t.Errorf("expected type 'transaction.updated', got %s", event.Type)
+	}
+	if !event.Known() {
+		t.Error("expected transaction.updated to be a known event type")
+	}
+
+	tx, err := event.Transaction()
+	if err != nil {
+		t.Fatalf("Transaction returned an error: %v", err)
+	}
+	if tx.ID != "tx_001" || tx.Notes != "coffee" || !tx.Settled.Valid() {
+		t.Errorf("unexpected transaction: %+v", tx)
+	}
+
+	payload, err := event.Payload()
+	if err != nil {
+		t.Fatalf("Payload returned an error: %v", err)
+	}
+	if p, ok := payload.(*Transaction); !ok || p.ID != "tx_001" {
+		t.Errorf("expected *Transaction payload, got %T", payload)
+	}
+}
+
+func TestParseWebhookEvent_UnknownType(t *testing.T) {
+	req := newWebhookRequest(`{"type": "account.updated", "data": {"id": "acc_001", "closed": true}}`)
+
+	event, err := ParseWebhookEvent(req)
+	if err != nil {
+		t.Fatalf("ParseWebhookEvent returned an error: %v", err)
+	}
+	if event.Type != "account.updated" || event.Known() {
+		t.Errorf("expected unknown type 'account.updated', got %s (known: %v)", event.Type, event.Known())
+	}
+
+	payload, err := event.Payload()
+	if err != nil {
+		t.Fatalf("Payload returned an error: %v", err)
+	}
+	raw, ok := payload.(json.RawMessage)
+	if !ok || !strings.Contains(string(raw), `"closed": true`) {
+		t.Errorf("expected raw JSON payload, got %T %s", payload, payload)
+	}
+
+	if _, err := event.Transaction(); err == nil {
+		t.Error("expected an error decoding an account.updated event as a transaction")
+	}
+
+	var data struct {
+		ID     string `json:"id"`
+		Closed bool   `json:"closed"`
+	}
+	if err := event.Decode(&data); err != nil {
+		t.Fatalf("Decode returned an error: %v", err)
+	}
+	if data.ID != "acc_001" || !data.Closed {
+		t.Errorf("unexpected decoded data: %+v", data)
+	}
+}
+
+func TestParseWebhookEvent_Invalid(t *testing.T) {
+	for _, body := range []string{`{invalid`, `{"data": {}}`} {
+		if _, err := ParseWebhookEvent(newWebhookRequest(body)); err == nil {
+			t.Errorf("expected an error for body %s, got nil", body)
+		}
+	}
+}
+
+func TestRegisterWebhookEventType(t *testing.T) {
+	type potUpdated struct {
+		ID      string `json:"id"`
+		Balance int64  `json:"balance"`
+	}
+	const eventType WebhookEventType = "test.pot_updated"
+	RegisterWebhookEventType(eventType, func() any { return new(potUpdated) })
+	defer func() {
+		webhookRegistry.Lock()
+		delete(webhookRegistry.types, eventType)
+		webhookRegistry.Unlock()
+	}()
+
+	event, err := ParseWebhookEvent(newWebhookRequest(`{"type": "test.pot_updated", "data": {"id": "pot_001", "balance": 1000}}`))
+	if err != nil {
+		t.Fatalf("ParseWebhookEvent returned an error: %v", err)
+	}
+	if !event.Known() {
+		t.Error("expected registered type to be known")
+	}
+
+	payload, err := event.Payload()
+	if err != nil {
+		t.Fatalf("Payload returned an error: %v", err)
+	}
+	pot, ok := payload.(*potUpdated)
+	if !ok || pot.ID != "pot_001" || pot.Balance != 1000 {
+		t.Errorf("unexpected payload: %T %+v", payload, payload)
+	}
+
+	if _, err := event.Transaction(); err == nil {
+		t.Error("expected an error decoding a non-transaction event as a transaction")
+	}
+}
+
+func TestParseWebhookEvent_UnknownFields(t *testing.T) {
+	body := `{
+		"type": "transaction.created",
+		"delivery_id": "whdel_001",
+		"data": {
+			"id": "tx_001",
+			"amount": -350,
+			"carbon_footprint": {"kg": 1.2},
+			"merchant": {"id": "merch_001", "sustainability_score": 7}
+		}
+	}`
+
+	t.Run("lenient by default", func(t *testing.T) {
+		event, err := ParseWebhookEvent(newWebhookRequest(body))
+		if err != nil {
+			t.Fatalf("ParseWebhookEvent returned an error: %v", err)
+		}
+		if string(event.Extra["delivery_id"]) != `"whdel_001"` {
+			t.Errorf("expected delivery_id in Extra, got %v", event.Extra)
+		}
+		if string(event.Extra["data.carbon_footprint"]) != `{"kg": 1.2}` {
+			t.Errorf("expected data.carbon_footprint in Extra, got %v", event.Extra)
+		}
+		if _, ok := event.Extra["data.amount"]; ok {
+			t.Error("expected known field data.amount not to be in Extra")
+		}
+		if len(event.Extra) != 2 {
+			t.Errorf("expected 2 extra fields, got %d: %v", len(event.Extra), event.Extra)
+		}
+
+		tx, err := event.Transaction()
+		if err != nil {
+			t.Fatalf("Transaction returned an error: %v", err)
+		}
+		if tx.ID != "tx_001" || tx.Amount != -350 {
+			t.Errorf("unexpected transaction: %+v", tx)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		if _, err := ParseWebhookEvent(newWebhookRequest(body), WithStrictWebhookDecoding()); err == nil {
+			t.Error("expected an error for unknown fields in strict mode, got nil")
+		}
+		if _, err := ParseWebhookTransactionCreated(newWebhookRequest(body), WithStrictWebhookDecoding()); err == nil {
+			t.Error("expected an error for unknown fields in strict mode, got nil")
+		}
+	})
+
+	t.Run("no unknown fields", func(t *testing.T) {
+		event, err := ParseWebhookEvent(newWebhookRequest(txCreatedWebhook), WithStrictWebhookDecoding())
+		if err != nil {
+			t.Fatalf("ParseWebhookEvent returned an error: %v", err)
+		}
+		if event.Extra != nil {
+			t.Errorf("expected nil Extra, got %v", event.Extra)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package monzoauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+)
+
+// Defaults for ApprovalOptions.
+const (
+	DefaultApprovalInterval    = 2 * time.Second
+	DefaultApprovalMaxInterval = 15 * time.Second
+	DefaultApprovalTimeout     = 5 * time.Minute
+)
+
+// ErrApprovalTimeout matches the *ApprovalTimeoutError returned by
+// WaitForApproval when the user doesn't approve access in time.
+var ErrApprovalTimeout = errors.New("monzoauth: timed out waiting for approval")
+
+// ApprovalTimeoutError is returned by WaitForApproval when the user hasn't
+// approved access by the timeout. It matches ErrApprovalTimeout, and
+// unwraps to the last error from the API.
+type ApprovalTimeoutError struct {
+	// Elapsed is how long WaitForApproval waited.
+	Elapsed time.Duration
+	// Attempts is the number of times the API was polled.
+	Attempts int
+	// Err is the last error from the API.
+	Err error
+}
+
+// Error implements error.
+func (e *ApprovalTimeoutError) Error() string {
+	return fmt.Sprintf("monzoauth: access not approved in the Monzo app after %s (%d attempts)", e.Elapsed.Round(time.Second), e.Attempts)
+}
+
+// Is reports whether target is ErrApprovalTimeout.
+func (e *ApprovalTimeoutError) Is(target error) bool {
+	return target == ErrApprovalTimeout
+}
+
+// Unwrap returns the last error from the API.
+func (e *ApprovalTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// ApprovalProgress describes a WaitForApproval poll that found access
+// still unapproved.
+type ApprovalProgress struct {
+	// Attempt is the number of polls made so far, starting at 1.
+	Attempt int
+	// Elapsed is the time since WaitForApproval was called.
+	Elapsed time.Duration
+	// NextPoll is how long until the next poll.
+	NextPoll time.Duration
+	// Err is the error the poll returned.
+	Err error
+}
+
+// ApprovalOptions configures WaitForApproval. The zero value uses the
+// defaults.
+type ApprovalOptions struct {
+	// Interval is the delay before the first retry. It doubles after each
+	// poll, up to MaxInterval. It defaults to DefaultApprovalInterval.
+	Interval time.Duration
+	// MaxInterval caps the delay between polls. It defaults to
+	// DefaultApprovalMaxInterval.
+	MaxInterval time.Duration
+	// Timeout is how long to wait for approval. It defaults to
+	// DefaultApprovalTimeout.
+	Timeout time.Duration
+	// OnWaiting, if set, is called after each poll that finds access
+	// still unapproved, e.g. to remind the user to open the Monzo app.
+	OnWaiting func(ApprovalProgress)
+}
+
+// WaitForApproval waits for the user to approve access in the Monzo app,
+// as Strong Customer Authentication requires after every login. Until
+// they do, the API rejects requests with an error matching
+// monzo.ErrInsufficientPermissions.
+//
+// It polls the accounts endpoint, backing off between polls, and returns
+// nil as soon as the request succeeds. It returns an *ApprovalTimeoutError
+// if the timeout passes first, ctx's error if ctx is done, and any other
+// error, including other 403s, straight away. opts may be nil.
+func WaitForApproval(ctx context.Context, client *monzo.Client, opts *ApprovalOptions) error {
+	var o ApprovalOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultApprovalInterval
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = DefaultApprovalMaxInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultApprovalTimeout
+	}
+
+	start := time.Now()
+	deadline := start.Add(o.Timeout)
+	interval := o.Interval
+	for attempt := 1; ; attempt++ {
+		_, err := client.ListAccounts(ctx, "")
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, monzo.ErrInsufficientPermissions) {
+			return err
+		}
+
+		// Poll once more at the deadline, rather than giving up early.
+		wait := min(interval, time.Until(deadline))
+		if wait <= 0 {
+			return &ApprovalTimeoutError{Elapsed: time.Since(start), Attempts: attempt, Err: err}
+		}
+		if o.OnWaiting != nil {
+			o.OnWaiting(ApprovalProgress{Attempt: attempt, Elapsed: time.Since(start), NextPoll: wait, Err: err})
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		interval = min(interval*2, o.MaxInterval)
+	}
+}
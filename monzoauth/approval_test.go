@@ -0,0 +1,104 @@
+package monzoauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+	"github.com/petermakeswebsites/go-monzo/monzotest"
+)
+
+// failUnapproved queues n responses rejecting GET /accounts as Monzo does
+// before the user has approved access.
+func failUnapproved(srv *monzotest.Server, n int) {
+	for range n {
+		srv.FailNext(http.MethodGet, "/accounts", http.StatusForbidden, "forbidden.insufficient_permissions", "Insufficient permissions")
+	}
+}
+
+func TestWaitForApproval(t *testing.T) {
+	srv, client := monzotest.New(t, monzo.WithRetryPolicy(monzo.NoRetries))
+	failUnapproved(srv, 2)
+
+	var progress []ApprovalProgress
+	err := WaitForApproval(context.Background(), client, &ApprovalOptions{
+		Interval:    time.Millisecond,
+		MaxInterval: 2 * time.Millisecond,
+		OnWaiting:   func(p ApprovalProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("WaitForApproval returned an error: %v", err)
+	}
+	if len(progress) != 2 {
+		t.Fatalf("expected 2 progress reports, got %d", len(progress))
+	}
+	if progress[0].Attempt != 1 || progress[1].Attempt != 2 {
+		t.Errorf("expected attempts 1 and 2, got %d and %d", progress[0].Attempt, progress[1].Attempt)
+	}
+	if progress[0].NextPoll != time.Millisecond || progress[1].NextPoll != 2*time.Millisecond {
+		t.Errorf("expected the interval to back off, got %s and %s", progress[0].NextPoll, progress[1].NextPoll)
+	}
+	if !errors.Is(progress[0].Err, monzo.ErrInsufficientPermissions) {
+		t.Errorf("expected the API error to be reported, got %v", progress[0].Err)
+	}
+}
+
+func TestWaitForApprovalTimeout(t *testing.T) {
+	srv, client := monzotest.New(t, monzo.WithRetryPolicy(monzo.NoRetries))
+	failUnapproved(srv, 1000)
+
+	err := WaitForApproval(context.Background(), client, &ApprovalOptions{
+		Interval: 5 * time.Millisecond,
+		Timeout:  30 * time.Millisecond,
+	})
+	if !errors.Is(err, ErrApprovalTimeout) {
+		t.Fatalf("expected ErrApprovalTimeout, got %v", err)
+	}
+	var timeoutErr *ApprovalTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected an *ApprovalTimeoutError, got %T", err)
+	}
+	if timeoutErr.Attempts < 2 {
+		t.Errorf("expected several attempts, got %d", timeoutErr.Attempts)
+	}
+	if !errors.Is(err, monzo.ErrInsufficientPermissions) {
+		t.Errorf("expected the last API error to be wrapped, got %v", err)
+	}
+}
+
+func TestWaitForApprovalOtherError(t *testing.T) {
+	srv, client := monzotest.New(t, monzo.WithRetryPolicy(monzo.NoRetries))
+	srv.FailNext(http.MethodGet, "/accounts", http.StatusUnauthorized, "unauthorized.bad_access_token", "Bad token")
+	srv.FailNext(http.MethodGet, "/accounts", http.StatusForbidden, "forbidden.verification_required", "Verification required")
+
+	polls := 0
+	opts := &ApprovalOptions{Interval: time.Millisecond, OnWaiting: func(ApprovalProgress) { polls++ }}
+	if err := WaitForApproval(context.Background(), client, opts); !errors.Is(err, monzo.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized straight away, got %v", err)
+	}
+	// A 403 for any other reason than pending approval isn't waited out.
+	err := WaitForApproval(context.Background(), client, opts)
+	if !errors.Is(err, monzo.ErrForbidden) || errors.Is(err, monzo.ErrInsufficientPermissions) {
+		t.Errorf("expected the other 403 straight away, got %v", err)
+	}
+	if polls != 0 {
+		t.Errorf("expected no retries, got %d", polls)
+	}
+}
+
+func TestWaitForApprovalContext(t *testing.T) {
+	srv, client := monzotest.New(t, monzo.WithRetryPolicy(monzo.NoRetries))
+	failUnapproved(srv, 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := WaitForApproval(ctx, client, &ApprovalOptions{
+		Interval:  time.Hour,
+		OnWaiting: func(ApprovalProgress) { cancel() },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
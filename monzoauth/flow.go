@@ -0,0 +1,216 @@
+package monzoauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultStateTTL is how long a login started by a Flow can take,
+	// unless changed with WithStateTTL.
+	DefaultStateTTL = 10 * time.Minute
+	// DefaultMaxPendingStates is how many logins a Flow tracks at once,
+	// unless changed with WithMaxPendingStates.
+	DefaultMaxPendingStates = 1000
+)
+
+// StateCookieName is the cookie AuthCodeURL binds a login's state to the
+// browser with.
+const StateCookieName = "monzoauth_state"
+
+var (
+	// ErrInvalidState is returned when the state in a callback wasn't
+	// issued by the Flow, has already been used, or wasn't issued to the
+	// browser the callback came from.
+	ErrInvalidState = errors.New("monzoauth: invalid state")
+	// ErrStateExpired is returned when the state in a callback was issued
+	// by the Flow, but the login took longer than its TTL.
+	ErrStateExpired = errors.New("monzoauth: state expired")
+)
+
+// CallbackError is returned by HandleCallback when Monzo redirects back
+// with an error instead of a code, e.g. because the user cancelled.
+type CallbackError struct {
+	// Code is the OAuth2 error code, e.g. "access_denied".
+	Code string
+	// Description is the human-readable description, if any.
+	Description string
+}
+
+// Error implements error.
+func (e *CallbackError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("monzoauth: login failed: %s", e.Code)
+	}
+	return fmt.Sprintf("monzoauth: login failed: %s: %s", e.Code, e.Description)
+}
+
+// Flow runs logins for a Config. Each login gets its own random state,
+// which is valid for one callback within the state TTL, so any number of
+// logins can be in progress at once. AuthCodeURL also stores the state in
+// a cookie, and HandleCallback checks it, so a login can only be finished
+// by the browser that started it. A Flow is safe for concurrent use.
+type Flow struct {
+	cfg        *Config
+	ttl        time.Duration
+	maxPending int
+	now        func() time.Time
+
+	mu     sync.Mutex
+	states map[string]time.Time // state to its expiry
+}
+
+// FlowOption configures a Flow.
+type FlowOption func(*Flow)
+
+// WithStateTTL sets how long a login can take, from AuthCodeURL to the
+// callback. Values below 1 are ignored.
+func WithStateTTL(ttl time.Duration) FlowOption {
+	return func(f *Flow) {
+		if ttl > 0 {
+			f.ttl = ttl
+		}
+	}
+}
+
+// WithMaxPendingStates sets how many logins can be in progress at once.
+// Once there are n, starting another forgets the one that would expire
+// soonest. Values below 1 are ignored.
+func WithMaxPendingStates(n int) FlowOption {
+	return func(f *Flow) {
+		if n > 0 {
+			f.maxPending = n
+		}
+	}
+}
+
+// NewFlow returns a Flow for cfg.
+func NewFlow(cfg *Config, opts ...FlowOption) *Flow {
+	f := &Flow{
+		cfg:        cfg,
+		ttl:        DefaultStateTTL,
+		maxPending: DefaultMaxPendingStates,
+		now:        time.Now,
+		states:     make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// NewState returns a new random state and records it as issued. Use it
+// with Config.OAuth2Config().AuthCodeURL and Exchange to run the login
+// yourself, in which case binding the state to the user's browser, e.g.
+// in their session, is up to you; otherwise use AuthCodeURL and
+// HandleCallback.
+func (f *Flow) NewState() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("monzoauth: generate state: %w", err)
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	for s, expires := range f.states {
+		if !now.Before(expires) {
+			delete(f.states, s)
+		}
+	}
+	// Forget the oldest logins rather than growing without limit.
+	for len(f.states) >= f.maxPending {
+		var oldest string
+		for s, expires := range f.states {
+			if oldest == "" || expires.Before(f.states[oldest]) {
+				oldest = s
+			}
+		}
+		delete(f.states, oldest)
+	}
+	f.states[state] = now.Add(f.ttl)
+	return state, nil
+}
+
+// AuthCodeURL starts a login, returning the Monzo URL to send the user to.
+// It sets the StateCookieName cookie on w, so the response must go to the
+// user's browser. Starting another login in the same browser replaces the
+// cookie, so only the latest can be finished.
+func (f *Flow) AuthCodeURL(w http.ResponseWriter, opts ...oauth2.AuthCodeOption) (string, error) {
+	state, err := f.NewState()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     StateCookieName,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(f.ttl / time.Second),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(f.cfg.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return f.cfg.OAuth2Config().AuthCodeURL(state, opts...), nil
+}
+
+// VerifyState checks that state was issued by the Flow and hasn't
+// expired, and uses it up so it can't be replayed. It returns
+// ErrInvalidState or ErrStateExpired if not. It doesn't check which
+// browser the state was issued to; HandleCallback does.
+func (f *Flow) VerifyState(state string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	expires, ok := f.states[state]
+	if !ok || state == "" {
+		return ErrInvalidState
+	}
+	delete(f.states, state)
+	if !f.now().Before(expires) {
+		return ErrStateExpired
+	}
+	return nil
+}
+
+// Exchange verifies state and exchanges code for a token.
+func (f *Flow) Exchange(ctx context.Context, state, code string) (*oauth2.Token, error) {
+	if err := f.VerifyState(state); err != nil {
+		return nil, err
+	}
+	return f.cfg.Exchange(ctx, code)
+}
+
+// HandleCallback completes a login from the request Monzo redirected the
+// user to. It returns a *CallbackError if Monzo reported an error,
+// ErrInvalidState or ErrStateExpired if the state doesn't check out or
+// doesn't match the cookie set by AuthCodeURL, and otherwise exchanges
+// the code for a token.
+func (f *Flow) HandleCallback(r *http.Request) (*oauth2.Token, error) {
+	query := r.URL.Query()
+	state := query.Get("state")
+	if code := query.Get("error"); code != "" {
+		// Use up the state, so the login can't be completed later.
+		f.VerifyState(state)
+		return nil, &CallbackError{Code: code, Description: query.Get("error_description")}
+	}
+
+	// Without this check, anyone could start a login with their own
+	// account and send the callback link to someone else, logging them
+	// in as the attacker.
+	cookie, err := r.Cookie(StateCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return nil, fmt.Errorf("%w: state wasn't issued to this browser", ErrInvalidState)
+	}
+	return f.Exchange(r.Context(), state, query.Get("code"))
+}
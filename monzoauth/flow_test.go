@@ -0,0 +1,188 @@
+package monzoauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// startLogin calls AuthCodeURL, returning the state in the URL and the
+// state cookie it set.
+func startLogin(t *testing.T, flow *Flow) (string, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	authURL, err := flow.AuthCodeURL(rec)
+	if err != nil {
+		t.Fatalf("AuthCodeURL returned an error: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("AuthCodeURL returned an invalid URL: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != StateCookieName {
+		t.Fatalf("expected the state cookie to be set, got %v", cookies)
+	}
+	return u.Query().Get("state"), cookies[0]
+}
+
+// newState calls NewState, failing the test on error.
+func newState(t *testing.T, flow *Flow) string {
+	t.Helper()
+	state, err := flow.NewState()
+	if err != nil {
+		t.Fatalf("NewState returned an error: %v", err)
+	}
+	return state
+}
+
+func TestFlowState(t *testing.T) {
+	flow := NewFlow(testConfig(t))
+
+	// Concurrent logins each get their own state.
+	a, _ := startLogin(t, flow)
+	b, _ := startLogin(t, flow)
+	if a == "" || a == b {
+		t.Fatalf("expected two distinct states, got %q and %q", a, b)
+	}
+	if err := flow.VerifyState(b); err != nil {
+		t.Errorf("expected state b to be valid, got %v", err)
+	}
+	if err := flow.VerifyState(a); err != nil {
+		t.Errorf("expected state a to be valid, got %v", err)
+	}
+
+	// States can only be used once.
+	if err := flow.VerifyState(a); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState for a reused state, got %v", err)
+	}
+	if err := flow.VerifyState("forged"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState for an unknown state, got %v", err)
+	}
+	if err := flow.VerifyState(""); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState for an empty state, got %v", err)
+	}
+
+	// States issued by another flow aren't accepted.
+	other := NewFlow(testConfig(t))
+	if err := other.VerifyState(newState(t, flow)); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState for another flow's state, got %v", err)
+	}
+}
+
+func TestFlowStateExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	flow := NewFlow(testConfig(t), WithStateTTL(time.Minute))
+	flow.now = func() time.Time { return now }
+
+	state := newState(t, flow)
+	now = now.Add(time.Minute)
+	if err := flow.VerifyState(state); !errors.Is(err, ErrStateExpired) {
+		t.Errorf("expected ErrStateExpired, got %v", err)
+	}
+
+	// Expired states are dropped when new ones are issued.
+	newState(t, flow)
+	now = now.Add(time.Minute)
+	newState(t, flow)
+	if n := len(flow.states); n != 1 {
+		t.Errorf("expected 1 outstanding state, got %d", n)
+	}
+}
+
+func TestFlowMaxPendingStates(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	flow := NewFlow(testConfig(t), WithMaxPendingStates(2))
+	flow.now = func() time.Time { return now }
+
+	var states []string
+	for range 3 {
+		states = append(states, newState(t, flow))
+		now = now.Add(time.Second)
+	}
+	if n := len(flow.states); n != 2 {
+		t.Errorf("expected 2 outstanding states, got %d", n)
+	}
+	if err := flow.VerifyState(states[0]); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected the oldest state to be forgotten, got %v", err)
+	}
+	if err := flow.VerifyState(states[2]); err != nil {
+		t.Errorf("expected the newest state to be valid, got %v", err)
+	}
+}
+
+func TestFlowStateCookie(t *testing.T) {
+	flow := NewFlow(testConfig(t), WithStateTTL(time.Minute))
+	_, cookie := startLogin(t, flow)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge != 60 {
+		t.Errorf("unexpected cookie: %+v", cookie)
+	}
+	if cookie.Secure {
+		t.Error("expected an insecure cookie for an http redirect URL")
+	}
+
+	cfg := testConfig(t)
+	cfg.RedirectURL = "https://example.com/auth/callback"
+	if _, cookie := startLogin(t, NewFlow(cfg)); !cookie.Secure {
+		t.Error("expected a secure cookie for an https redirect URL")
+	}
+}
+
+func TestFlowHandleCallback(t *testing.T) {
+	flow := NewFlow(testConfig(t))
+	state, cookie := startLogin(t, flow)
+
+	r := httptest.NewRequest("GET", "/auth/callback?code=code_123&state="+state, nil)
+	r.AddCookie(cookie)
+	token, err := flow.HandleCallback(r)
+	if err != nil {
+		t.Fatalf("HandleCallback returned an error: %v", err)
+	}
+	if token.AccessToken != "access_new" {
+		t.Errorf("expected access_new, got %s", token.AccessToken)
+	}
+
+	// Replaying the callback fails before the code is exchanged.
+	if _, err := flow.HandleCallback(r); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState for a replayed callback, got %v", err)
+	}
+}
+
+func TestFlowHandleCallbackOtherBrowser(t *testing.T) {
+	flow := NewFlow(testConfig(t))
+
+	// An attacker starts a login and sends the callback link to a victim,
+	// whose browser has no state cookie, or one for their own login.
+	state, _ := startLogin(t, flow)
+	_, victimCookie := startLogin(t, flow)
+	for name, cookie := range map[string]*http.Cookie{"no cookie": nil, "other login": victimCookie} {
+		r := httptest.NewRequest("GET", "/auth/callback?code=code_123&state="+state, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		if _, err := flow.HandleCallback(r); !errors.Is(err, ErrInvalidState) {
+			t.Errorf("%s: expected ErrInvalidState, got %v", name, err)
+		}
+	}
+}
+
+func TestFlowHandleCallbackError(t *testing.T) {
+	flow := NewFlow(testConfig(t))
+	state := newState(t, flow)
+
+	r := httptest.NewRequest("GET", "/auth/callback?error=access_denied&error_description=Cancelled&state="+state, nil)
+	_, err := flow.HandleCallback(r)
+	var callbackErr *CallbackError
+	if !errors.As(err, &callbackErr) {
+		t.Fatalf("expected a *CallbackError, got %v", err)
+	}
+	if callbackErr.Code != "access_denied" || callbackErr.Description != "Cancelled" {
+		t.Errorf("unexpected error: %+v", callbackErr)
+	}
+	if err := flow.VerifyState(state); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected the state to be used up, got %v", err)
+	}
+}
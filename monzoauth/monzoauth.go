@@ -0,0 +1,163 @@
+// Package monzoauth implements Monzo's OAuth2 login flow on top of
+// golang.org/x/oauth2.
+//
+// A Flow sends the user to Monzo to log in and checks the state Monzo
+// sends back against a cookie, so concurrent logins can't be mixed up or
+// forged. Once the code is exchanged, Config.Client returns a ready
+// monzo.Client:
+//
+//	cfg := &monzoauth.Config{
+//		ClientID:     clientID,
+//		ClientSecret: clientSecret,
+//		RedirectURL:  "http://localhost:8080/auth/callback",
+//	}
+//	flow := monzoauth.NewFlow(cfg)
+//
+//	// In the login handler:
+//	authURL, err := flow.AuthCodeURL(w)
+//	if err != nil {
+//		http.Error(w, "Login failed", http.StatusInternalServerError)
+//		return
+//	}
+//	http.Redirect(w, r, authURL, http.StatusFound)
+//
+//	// In the callback handler:
+//	token, err := flow.HandleCallback(r)
+//	if err != nil {
+//		http.Error(w, "Login failed", http.StatusForbidden)
+//		return
+//	}
+//	client := cfg.Client(ctx, token)
+//
+// Remember that Monzo only grants access once the user has also approved
+// the login in the Monzo app.
+package monzoauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+	"golang.org/x/oauth2"
+)
+
+// Endpoint is Monzo's OAuth2 endpoint. Monzo expects the client
+// credentials in the token request body.
+var Endpoint = oauth2.Endpoint{
+	AuthURL:   "https://auth.monzo.com/",
+	TokenURL:  "https://api.monzo.com/oauth2/token",
+	AuthStyle: oauth2.AuthStyleInParams,
+}
+
+// ErrTokenExpired is returned when a non-confidential client's token has
+// expired. Such tokens can't be refreshed, so the user must log in again.
+var ErrTokenExpired = errors.New("monzoauth: token expired")
+
+// ClientType is the type of an OAuth client, as chosen when it was
+// created in the Monzo Developer Portal.
+type ClientType int
+
+const (
+	// Confidential clients can keep their secret safe, e.g. on a server.
+	// Their tokens come with a refresh token.
+	Confidential ClientType = iota
+	// NonConfidential clients run where their secret could be read, e.g.
+	// in a desktop or mobile app. Their tokens can't be refreshed.
+	NonConfidential
+)
+
+// String returns the name of the client type.
+func (t ClientType) String() string {
+	switch t {
+	case Confidential:
+		return "confidential"
+	case NonConfidential:
+		return "non-confidential"
+	default:
+		return fmt.Sprintf("ClientType(%d)", int(t))
+	}
+}
+
+// Config describes an OAuth client registered with Monzo.
+type Config struct {
+	// ClientID and ClientSecret identify the client.
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must exactly match a redirect URL set for the client.
+	RedirectURL string
+	// Type is the client's type. It defaults to Confidential.
+	Type ClientType
+	// Endpoint overrides Endpoint, e.g. to point at a fake in tests.
+	Endpoint *oauth2.Endpoint
+	// ClientOptions are passed to monzo.NewClient by Client.
+	ClientOptions []monzo.Option
+}
+
+// OAuth2Config returns the golang.org/x/oauth2 configuration for the
+// client.
+func (c *Config) OAuth2Config() *oauth2.Config {
+	endpoint := Endpoint
+	if c.Endpoint != nil {
+		endpoint = *c.Endpoint
+	}
+	return &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURL:  c.RedirectURL,
+		Endpoint:     endpoint,
+	}
+}
+
+// Exchange exchanges an authorization code for a token. Most callers
+// should use Flow.Exchange or Flow.HandleCallback, which check the state
+// first.
+func (c *Config) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	if code == "" {
+		return nil, errors.New("monzoauth: no authorization code")
+	}
+	token, err := c.OAuth2Config().Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("monzoauth: exchange code: %w", err)
+	}
+	return token, nil
+}
+
+// TokenSource returns a TokenSource for token. For confidential clients
+// it refreshes the token when it expires. For non-confidential clients it
+// returns ErrTokenExpired instead.
+//
+// Wrap the result with monzo.PersistingTokenSource to save refreshed
+// tokens.
+func (c *Config) TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	if c.Type == NonConfidential {
+		return &staticTokenSource{token: token}
+	}
+	return c.OAuth2Config().TokenSource(ctx, token)
+}
+
+// Client returns a monzo.Client authorised with token, configured with
+// ClientOptions followed by opts.
+func (c *Config) Client(ctx context.Context, token *oauth2.Token, opts ...monzo.Option) *monzo.Client {
+	return c.ClientFromTokenSource(ctx, c.TokenSource(ctx, token), opts...)
+}
+
+// ClientFromTokenSource is like Client, but takes its tokens from ts, such
+// as one returned by monzo.StoredTokenSource.
+func (c *Config) ClientFromTokenSource(ctx context.Context, ts oauth2.TokenSource, opts ...monzo.Option) *monzo.Client {
+	opts = append(append([]monzo.Option(nil), c.ClientOptions...), opts...)
+	return monzo.NewClient(oauth2.NewClient(ctx, ts), opts...)
+}
+
+// staticTokenSource returns its token until it expires.
+type staticTokenSource struct {
+	token *oauth2.Token
+}
+
+// Token implements oauth2.TokenSource.
+func (s *staticTokenSource) Token() (*oauth2.Token, error) {
+	if !s.token.Valid() {
+		return nil, ErrTokenExpired
+	}
+	return s.token, nil
+}
@@ -0,0 +1,124 @@
+package monzoauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+	"golang.org/x/oauth2"
+)
+
+// newTokenServer starts a fake Monzo token endpoint that accepts the code
+// "code_123" and the refresh token "refresh_old".
+func newTokenServer(t *testing.T) *oauth2.Endpoint {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "client" || r.FormValue("client_secret") != "secret" {
+			t.Errorf("expected client credentials in the body, got %v", r.Form)
+		}
+		switch {
+		case r.FormValue("grant_type") == "authorization_code" && r.FormValue("code") == "code_123":
+			if r.FormValue("redirect_uri") != "http://localhost:8080/auth/callback" {
+				t.Errorf("expected the redirect URL, got %s", r.FormValue("redirect_uri"))
+			}
+		case r.FormValue("grant_type") == "refresh_token" && r.FormValue("refresh_token") == "refresh_old":
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "access_new", "token_type": "Bearer", "refresh_token": "refresh_new", "expires_in": 3600}`))
+	}))
+	t.Cleanup(srv.Close)
+	return &oauth2.Endpoint{AuthURL: "https://auth.monzo.com/", TokenURL: srv.URL, AuthStyle: oauth2.AuthStyleInParams}
+}
+
+func testConfig(t *testing.T) *Config {
+	return &Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/callback",
+		Endpoint:     newTokenServer(t),
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	cfg := (&Config{ClientID: "client"}).OAuth2Config()
+	if cfg.Endpoint != Endpoint {
+		t.Errorf("expected the Monzo endpoint by default, got %+v", cfg.Endpoint)
+	}
+	u, err := url.Parse(cfg.AuthCodeURL("xyz"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL returned an invalid URL: %v", err)
+	}
+	if u.Scheme != "https" || u.Host != "auth.monzo.com" {
+		t.Errorf("expected https://auth.monzo.com, got %s", u)
+	}
+}
+
+func TestConfigExchange(t *testing.T) {
+	cfg := testConfig(t)
+	token, err := cfg.Exchange(context.Background(), "code_123")
+	if err != nil {
+		t.Fatalf("Exchange returned an error: %v", err)
+	}
+	if token.AccessToken != "access_new" || token.RefreshToken != "refresh_new" {
+		t.Errorf("unexpected token: %+v", token)
+	}
+	if _, err := cfg.Exchange(context.Background(), "code_bad"); err == nil {
+		t.Error("expected an error for a bad code")
+	}
+	if _, err := cfg.Exchange(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty code")
+	}
+}
+
+func TestConfigClient(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer access_new" {
+			t.Errorf("expected the refreshed token, got %q", got)
+		}
+		w.Write([]byte(`{"authenticated": true, "client_id": "client", "user_id": "user_001"}`))
+	}))
+	defer api.Close()
+
+	cfg := testConfig(t)
+	cfg.ClientOptions = []monzo.Option{monzo.WithBaseURL(api.URL)}
+	expired := &oauth2.Token{AccessToken: "access_old", RefreshToken: "refresh_old", Expiry: time.Now().Add(-time.Hour)}
+
+	who, err := cfg.Client(context.Background(), expired).WhoAmI(context.Background())
+	if err != nil {
+		t.Fatalf("WhoAmI returned an error: %v", err)
+	}
+	if !who.Authenticated {
+		t.Error("expected to be authenticated")
+	}
+}
+
+func TestNonConfidentialTokenSource(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Type = NonConfidential
+
+	valid := &oauth2.Token{AccessToken: "access_1", Expiry: time.Now().Add(time.Hour)}
+	if token, err := cfg.TokenSource(context.Background(), valid).Token(); err != nil || token.AccessToken != "access_1" {
+		t.Errorf("expected the valid token, got %v, %v", token, err)
+	}
+
+	expired := &oauth2.Token{AccessToken: "access_1", RefreshToken: "refresh_old", Expiry: time.Now().Add(-time.Hour)}
+	if _, err := cfg.TokenSource(context.Background(), expired).Token(); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestClientTypeString(t *testing.T) {
+	if s := NonConfidential.String(); s != "non-confidential" {
+		t.Errorf("expected non-confidential, got %s", s)
+	}
+}
@@ -0,0 +1,567 @@
+// Package cassette records HTTP interactions to a file and replays them,
+// so tests of code that calls the Monzo API can run without a network.
+//
+// Record a session once against the real API, then replay it in CI:
+//
+//	rec, err := cassette.New("testdata/accounts.json", cassette.ModeReplay,
+//		cassette.WithTransport(oauthClient.Transport))
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer rec.Close()
+//	client := monzo.NewClient(rec.Client())
+//
+// Secrets are scrubbed before anything is written: Authorization and
+// Cookie headers are replaced, JSON and form fields holding tokens, OAuth
+// client secrets and codes, and bank details are redacted, and so are
+// webhook secrets in query strings, including URLs inside bodies.
+//
+// JSON bodies are kept as recorded, apart from redactions and whitespace.
+// Bodies that aren't valid UTF-8, such as attachments, are stored
+// base64-encoded so they replay byte for byte.
+//
+// Requests are matched to recorded interactions by method, path and query,
+// with the query normalised so that parameter order doesn't matter.
+// Matching interactions are replayed in the order they were recorded, so
+// a session that fetches the same URL twice replays both responses.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+)
+
+// Mode selects what a Recorder does with requests.
+type Mode int
+
+const (
+	// ModeReplay answers requests from the cassette file, without using
+	// the network. Requests that weren't recorded fail.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the real transport, and records them.
+	// The cassette file is written by Close.
+	ModeRecord
+	// ModePassthrough sends requests to the real transport without
+	// recording or replaying anything.
+	ModePassthrough
+)
+
+// String returns the name of the mode, as accepted by ParseMode.
+func (m Mode) String() string {
+	switch m {
+	case ModeReplay:
+		return "replay"
+	case ModeRecord:
+		return "record"
+	case ModePassthrough:
+		return "passthrough"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode parses "replay", "record" or "passthrough", e.g. from an
+// environment variable. An empty string is ModeReplay.
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "", "replay":
+		return ModeReplay, nil
+	case "record":
+		return ModeRecord, nil
+	case "passthrough":
+		return ModePassthrough, nil
+	}
+	return 0, fmt.Errorf("cassette: unknown mode %q", s)
+}
+
+// ErrNoInteraction is returned by RoundTrip in ModeReplay when a request
+// has no unused recorded interaction.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction")
+
+// Redacted replaces secrets in recorded interactions.
+const Redacted = "REDACTED"
+
+// formatVersion is the version of the on-disk format.
+const formatVersion = 1
+
+// defaultRedactedFields are the JSON and form fields redacted by default.
+var defaultRedactedFields = []string{
+	"access_token", "refresh_token", "client_secret",
+	"account_number", "sort_code",
+}
+
+// formRedactedFields are only redacted in form bodies. The OAuth
+// authorization code is sent as "code", but in JSON bodies "code" is
+// Monzo's error code, which must be kept for errors to replay.
+var formRedactedFields = []string{"code"}
+
+// queryRedactedParams are query parameters redacted wherever a URL or
+// query string appears, in addition to the redacted fields.
+var queryRedactedParams = []string{monzo.WebhookSecretParam}
+
+// redactedHeaders are request headers whose values are replaced.
+var redactedHeaders = []string{"Authorization", "Cookie"}
+
+// droppedHeaders are response headers that aren't recorded, because they
+// change on every request or may hold secrets.
+var droppedHeaders = []string{"Date", "Set-Cookie"}
+
+// File is the on-disk format of a cassette.
+type File struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request. Query is normalised; see NormaliseQuery.
+type Request struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body"`
+}
+
+// Body is a recorded request or response body. JSON bodies are stored as
+// JSON, so cassettes are readable and diff well; other UTF-8 bodies are
+// stored as text, and anything else as base64.
+type Body struct {
+	JSON   json.RawMessage `json:"json,omitempty"`
+	Text   string          `json:"text,omitempty"`
+	Binary []byte          `json:"binary,omitempty"`
+}
+
+// bytes returns the body's contents. JSON is compacted, undoing the
+// indentation of the cassette file.
+func (b Body) bytes() []byte {
+	switch {
+	case len(b.JSON) > 0:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, b.JSON); err != nil {
+			return b.JSON
+		}
+		return buf.Bytes()
+	case b.Binary != nil:
+		return b.Binary
+	}
+	return []byte(b.Text)
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithTransport sets the transport used to send real requests in
+// ModeRecord and ModePassthrough. It defaults to http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// WithRedactedFields adds JSON field names whose values are redacted
+// wherever they appear in a body, in addition to access_token,
+// refresh_token, client_secret, account_number and sort_code, and the
+// OAuth code in form bodies.
+func WithRedactedFields(names ...string) Option {
+	return func(r *Recorder) {
+		r.redact = append(r.redact, names...)
+	}
+}
+
+// Recorder is an http.RoundTripper that records or replays interactions.
+// It is safe for concurrent use, though interactions recorded
+// concurrently are stored in the order they complete.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	redact    []string
+	urlSecret *regexp.Regexp // matches redacted parameters in URLs
+
+	mu   sync.Mutex
+	file File
+	used []bool
+}
+
+// New creates a Recorder for the cassette file at path. In ModeReplay the
+// file must exist; in ModeRecord it is overwritten by Close.
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		redact:    slices.Clone(defaultRedactedFields),
+		file:      File{Version: formatVersion, Interactions: []Interaction{}},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	params := make([]string, 0, len(r.redact)+len(queryRedactedParams))
+	for _, name := range slices.Concat(r.redact, queryRedactedParams) {
+		params = append(params, regexp.QuoteMeta(name))
+	}
+	r.urlSecret = regexp.MustCompile(`([?&](?:` + strings.Join(params, "|") + `)=)[^&#\s]*`)
+
+	if mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, &r.file); err != nil {
+			return nil, fmt.Errorf("cassette: decode %s: %w", path, err)
+		}
+		if r.file.Version != formatVersion {
+			return nil, fmt.Errorf("cassette: %s has unsupported version %d", path, r.file.Version)
+		}
+		r.used = make([]bool, len(r.file.Interactions))
+	}
+	return r, nil
+}
+
+// Mode returns the recorder's mode.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an HTTP client that uses the recorder, for passing to
+// monzo.NewClient.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch r.mode {
+	case ModeReplay:
+		return r.replay(req)
+	case ModeRecord:
+		return r.record(req)
+	default:
+		return r.transport.RoundTrip(req)
+	}
+}
+
+// replay answers req with the first unused matching interaction.
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	query := r.query(req.URL.Query())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.file.Interactions {
+		if r.used[i] || in.Request.Method != req.Method || in.Request.Path != req.URL.Path || in.Request.Query != query {
+			continue
+		}
+		r.used[i] = true
+
+		body := in.Response.Body.bytes()
+		header := in.Response.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w for %s %s?%s", ErrNoInteraction, req.Method, req.URL.Path, query)
+}
+
+// record sends a copy of req with the real transport and records the
+// interaction. req itself isn't modified, as RoundTrip must not.
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		out.Body = io.NopCloser(bytes.NewReader(reqBody))
+		out.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(reqBody)), nil
+		}
+		out.ContentLength = int64(len(reqBody))
+	}
+
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	reqHeader := req.Header.Clone()
+	for _, name := range redactedHeaders {
+		if reqHeader.Get(name) != "" {
+			reqHeader.Set(name, Redacted)
+		}
+	}
+	respHeader := resp.Header.Clone()
+	for _, name := range droppedHeaders {
+		respHeader.Del(name)
+	}
+
+	in := Interaction{
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  r.query(req.URL.Query()),
+			Header: reqHeader,
+			Body:   r.body(reqBody),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     respHeader,
+			Body:       r.body(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	r.file.Interactions = append(r.file.Interactions, in)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// query redacts and normalises a request's query. Replayed requests are
+// redacted the same way, so they match what was recorded.
+func (r *Recorder) query(query url.Values) string {
+	redacted := make(url.Values, len(query))
+	for key, values := range query {
+		if slices.Contains(r.redact, key) || slices.Contains(queryRedactedParams, key) {
+			values = []string{Redacted}
+		}
+		redacted[key] = values
+	}
+	return NormaliseQuery(redacted)
+}
+
+// redactString redacts secrets in URLs within s.
+func (r *Recorder) redactString(s string) string {
+	return r.urlSecret.ReplaceAllString(s, "${1}"+Redacted)
+}
+
+// body converts data to a Body, redacting secrets. Form bodies have
+// redacted fields replaced as well as JSON bodies.
+func (r *Recorder) body(data []byte) Body {
+	if len(data) == 0 {
+		return Body{}
+	}
+
+	if redacted, err := r.redactJSON(data); err == nil {
+		return Body{JSON: redacted}
+	}
+
+	if !utf8.Valid(data) {
+		return Body{Binary: data}
+	}
+
+	if form, err := url.ParseQuery(string(data)); err == nil && strings.Contains(string(data), "=") {
+		changed := false
+		for name, values := range form {
+			if slices.Contains(r.redact, name) || slices.Contains(formRedactedFields, name) {
+				form.Set(name, Redacted)
+				changed = true
+				continue
+			}
+			for i, value := range values {
+				if redacted := r.redactString(value); redacted != value {
+					values[i] = redacted
+					changed = true
+				}
+			}
+		}
+		if changed {
+			return Body{Text: form.Encode()}
+		}
+	}
+	return Body{Text: r.redactString(string(data))}
+}
+
+// redactJSON returns data, which must hold a single JSON value, compacted
+// and with the values of redacted fields replaced anywhere in it. Keys
+// keep their order and strings aren't re-escaped, so the body replays as
+// it was recorded.
+func (r *Recorder) redactJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // keep int64 amounts exact
+	var buf bytes.Buffer
+	if err := r.copyJSON(&buf, dec); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("cassette: more than one JSON value")
+	}
+	return buf.Bytes(), nil
+}
+
+// copyJSON copies the next value from dec to buf, redacting it.
+func (r *Recorder) copyJSON(buf *bytes.Buffer, dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		buf.WriteRune(rune(tok))
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if tok == '[' {
+				if err := r.copyJSON(buf, dec); err != nil {
+					return err
+				}
+				continue
+			}
+
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			writeJSONString(buf, key.(string))
+			buf.WriteByte(':')
+			if slices.Contains(r.redact, key.(string)) {
+				var skip json.RawMessage
+				if err := dec.Decode(&skip); err != nil {
+					return err
+				}
+				writeJSONString(buf, Redacted)
+				continue
+			}
+			if err := r.copyJSON(buf, dec); err != nil {
+				return err
+			}
+		}
+		end, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		buf.WriteRune(rune(end.(json.Delim)))
+	case string:
+		writeJSONString(buf, r.redactString(tok))
+	case json.Number:
+		buf.WriteString(tok.String())
+	case bool:
+		fmt.Fprint(buf, tok)
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// writeJSONString writes s to buf as a JSON string, without escaping
+// HTML characters as json.Marshal does.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode adds a newline
+}
+
+// Close writes the cassette file in ModeRecord, replacing it atomically.
+// It does nothing in the other modes.
+func (r *Recorder) Close() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	r.mu.Lock()
+	err := enc.Encode(r.file)
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("cassette: encode: %w", err)
+	}
+	data := buf.Bytes()
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cassette: write %s: %w", r.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cassette: write %s: %w", r.path, err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("cassette: write %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// Unused returns the recorded interactions that haven't been replayed, so
+// tests can check that a session made every request it was expected to.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, in := range r.file.Interactions {
+		if i < len(r.used) && !r.used[i] {
+			unused = append(unused, in)
+		}
+	}
+	return unused
+}
+
+// NormaliseQuery encodes a query with its keys, and the values of each
+// key, sorted. Sorting values as well as keys means repeated parameters
+// such as expand[] match regardless of order.
+func NormaliseQuery(query url.Values) string {
+	sorted := make(url.Values, len(query))
+	for key, values := range query {
+		sorted[key] = slices.Sorted(slices.Values(values))
+	}
+	return sorted.Encode()
+}
@@ -0,0 +1,275 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+	"github.com/petermakeswebsites/go-monzo/monzotest"
+)
+
+// bearer adds an Authorization header, like an oauth2 transport.
+type bearer struct{ next http.RoundTripper }
+
+func (b bearer) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer secret-access-token")
+	return b.next.RoundTrip(req)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cassettes", "session.json")
+
+	srv, _ := monzotest.New(t)
+	acc := srv.AddAccount(monzo.Account{AccountNumber: "12345678", SortCode: "040004"}, 100_00)
+	for range 3 {
+		srv.AddTransaction(monzo.Transaction{AccountID: acc.ID, Amount: -100})
+	}
+
+	// Record a session against the fake server.
+	rec, err := New(path, ModeRecord, WithTransport(bearer{http.DefaultTransport}))
+	if err != nil {
+		t.Fatalf("New returned an error: %v", err)
+	}
+	client := monzo.NewClient(rec.Client(), monzo.WithBaseURL(srv.URL()))
+	accounts, err := client.ListAccounts(ctx, "")
+	if err != nil {
+		t.Fatalf("ListAccounts returned an error: %v", err)
+	}
+	if accounts[0].AccountNumber != "12345678" {
+		t.Errorf("expected the live response to be unredacted, got %s", accounts[0].AccountNumber)
+	}
+	recorded, err := monzo.All(client.Transactions(ctx, acc.ID, &monzo.TransactionsOptions{PageSize: 2}))
+	if err != nil {
+		t.Fatalf("Transactions returned an error: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cassette was not written: %v", err)
+	}
+	for _, secret := range []string{"secret-access-token", "12345678", "040004"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("expected %q to be redacted from the cassette", secret)
+		}
+	}
+
+	// Replay it without the server.
+	rec, err = New(path, ModeReplay)
+	if err != nil {
+		t.Fatalf("New returned an error: %v", err)
+	}
+	client = monzo.NewClient(rec.Client(), monzo.WithBaseURL("https://api.invalid"), monzo.WithRetryPolicy(monzo.NoRetries))
+	accounts, err = client.ListAccounts(ctx, "")
+	if err != nil {
+		t.Fatalf("ListAccounts returned an error: %v", err)
+	}
+	if accounts[0].ID != acc.ID || accounts[0].AccountNumber != Redacted {
+		t.Errorf("unexpected replayed account: %+v", accounts[0])
+	}
+	replayed, err := monzo.All(client.Transactions(ctx, acc.ID, &monzo.TransactionsOptions{PageSize: 2}))
+	if err != nil {
+		t.Fatalf("Transactions returned an error: %v", err)
+	}
+	if len(replayed) != len(recorded) || replayed[2].ID != recorded[2].ID {
+		t.Errorf("expected %d replayed transactions, got %d", len(recorded), len(replayed))
+	}
+	if unused := rec.Unused(); len(unused) != 0 {
+		t.Errorf("expected every interaction to be replayed, %d unused", len(unused))
+	}
+
+	// Interactions are used up.
+	_, err = client.ListAccounts(ctx, "")
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("expected ErrNoInteraction, got %v", err)
+	}
+}
+
+func TestRecordOAuthExchange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oauth.json")
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_secret") != "secret-client-secret" {
+			t.Errorf("expected the real client secret to be sent, got %q", r.FormValue("client_secret"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "secret-access-token", "refresh_token": "secret-refresh-token"}`))
+	}))
+	defer tokenServer.Close()
+
+	rec, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatalf("New returned an error: %v", err)
+	}
+	form := url.Values{"grant_type": {"authorization_code"}, "client_secret": {"secret-client-secret"}, "code": {"secret-auth-code"}}
+	req, _ := http.NewRequest(http.MethodPost, tokenServer.URL+"/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body := req.Body
+
+	resp, err := rec.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip returned an error: %v", err)
+	}
+	resp.Body.Close()
+	if req.Body != body {
+		t.Error("expected RoundTrip not to modify the request")
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, secret := range []string{"secret-client-secret", "secret-auth-code", "secret-access-token", "secret-refresh-token"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("expected %q to be redacted from the cassette", secret)
+		}
+	}
+}
+
+func TestRecordKeepsErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "errors.json")
+	srv, _ := monzotest.New(t)
+	srv.FailNext(http.MethodGet, "/accounts", http.StatusForbidden, "forbidden.insufficient_permissions", "Approve in app")
+
+	rec, _ := New(path, ModeRecord)
+	client := monzo.NewClient(rec.Client(), monzo.WithBaseURL(srv.URL()), monzo.WithRetryPolicy(monzo.NoRetries))
+	client.ListAccounts(ctx, "")
+	rec.Close()
+
+	rec, _ = New(path, ModeReplay)
+	client = monzo.NewClient(rec.Client(), monzo.WithBaseURL("https://api.invalid"), monzo.WithRetryPolicy(monzo.NoRetries))
+	if _, err := client.ListAccounts(ctx, ""); !errors.Is(err, monzo.ErrInsufficientPermissions) {
+		t.Errorf("expected the replayed error to keep its code, got %v", err)
+	}
+}
+
+func TestRecordWebhookSecrets(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	srv, _ := monzotest.New(t)
+	acc := srv.AddAccount(monzo.Account{}, 0)
+	hookURL := "https://example.com/hook?env=prod&monzo_secret=secret-webhook-secret"
+
+	rec, _ := New(path, ModeRecord)
+	client := monzo.NewClient(rec.Client(), monzo.WithBaseURL(srv.URL()))
+	if _, err := client.RegisterWebhook(ctx, acc.ID, hookURL); err != nil {
+		t.Fatalf("RegisterWebhook returned an error: %v", err)
+	}
+	if _, err := client.ListWebhooks(ctx, acc.ID); err != nil {
+		t.Fatalf("ListWebhooks returned an error: %v", err)
+	}
+	// A secret in the request's own query string, with a cookie.
+	req, _ := http.NewRequest(http.MethodGet, srv.URL()+"/ping/whoami?monzo_secret=secret-webhook-secret", nil)
+	req.Header.Set("Cookie", "session=secret-cookie")
+	resp, err := rec.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip returned an error: %v", err)
+	}
+	resp.Body.Close()
+	rec.Close()
+
+	data, _ := os.ReadFile(path)
+	for _, secret := range []string{"secret-webhook-secret", "secret-cookie"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("expected %q to be redacted from the cassette", secret)
+		}
+	}
+	if !strings.Contains(string(data), "env=prod") {
+		t.Error("expected the rest of the webhook URL to be kept")
+	}
+
+	// Requests still match, although their secrets were redacted.
+	rec, _ = New(path, ModeReplay)
+	client = monzo.NewClient(rec.Client(), monzo.WithBaseURL("https://api.invalid"), monzo.WithRetryPolicy(monzo.NoRetries))
+	client.RegisterWebhook(ctx, acc.ID, hookURL)
+	webhooks, err := client.ListWebhooks(ctx, acc.ID)
+	if err != nil || len(webhooks) != 1 {
+		t.Fatalf("expected 1 replayed webhook, got %v, %v", webhooks, err)
+	}
+	if webhooks[0].URL != "https://example.com/hook?env=prod&monzo_secret=REDACTED" {
+		t.Errorf("unexpected replayed URL %s", webhooks[0].URL)
+	}
+	req, _ = http.NewRequest(http.MethodGet, "https://api.invalid/ping/whoami?monzo_secret=another-secret", nil)
+	if _, err := rec.RoundTrip(req); err != nil {
+		t.Errorf("expected the request to match despite its secret, got %v", err)
+	}
+}
+
+func TestRecordBodiesVerbatim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bodies.json")
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, '\n'}
+	jsonBody := `{"zebra": 1, "alpha": "<b>&amp;</b>", "amount": 9007199254740993}`
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file" {
+			w.Write(binary)
+			return
+		}
+		w.Write([]byte(jsonBody))
+	}))
+	defer api.Close()
+
+	get := func(rec *Recorder, base, path string) []byte {
+		t.Helper()
+		resp, err := rec.Client().Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s returned an error: %v", path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return data
+	}
+
+	rec, _ := New(path, ModeRecord)
+	get(rec, api.URL, "/file")
+	get(rec, api.URL, "/json")
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+
+	rec, _ = New(path, ModeReplay)
+	if got := get(rec, "https://api.invalid", "/file"); !bytes.Equal(got, binary) {
+		t.Errorf("expected the binary body to replay unchanged, got %q", got)
+	}
+	want := `{"zebra":1,"alpha":"<b>&amp;</b>","amount":9007199254740993}`
+	if got := get(rec, "https://api.invalid", "/json"); string(got) != want {
+		t.Errorf("expected the JSON body to replay as recorded, got %s", got)
+	}
+}
+
+func TestNormaliseQuery(t *testing.T) {
+	a := NormaliseQuery(url.Values{"since": {"tx_1"}, "expand[]": {"merchant", "counterparty"}, "account_id": {"acc_1"}})
+	b := NormaliseQuery(url.Values{"account_id": {"acc_1"}, "expand[]": {"counterparty", "merchant"}, "since": {"tx_1"}})
+	if a != b {
+		t.Errorf("expected equal normalised queries, got %s and %s", a, b)
+	}
+	if c := NormaliseQuery(url.Values{"account_id": {"acc_1"}, "since": {"tx_2"}}); c == a {
+		t.Error("expected different pagination params to differ")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, mode := range []Mode{ModeReplay, ModeRecord, ModePassthrough} {
+		if got, err := ParseMode(mode.String()); err != nil || got != mode {
+			t.Errorf("ParseMode(%q) = %v, %v", mode.String(), got, err)
+		}
+	}
+	if _, err := ParseMode("rewind"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if _, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay); err == nil {
+		t.Error("expected an error replaying a missing cassette")
+	}
+}
@@ -0,0 +1,688 @@
+package monzotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+)
+
+// maxPageSize is the most transactions the API returns in one page.
+const maxPageSize = 100
+
+// routes returns the handler for the fake API.
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /ping/whoami", s.handleWhoAmI)
+	mux.HandleFunc("POST /oauth2/logout", s.handleLogout)
+
+	mux.HandleFunc("GET /accounts", s.handleListAccounts)
+	mux.HandleFunc("GET /balance", s.handleGetBalance)
+
+	mux.HandleFunc("GET /pots", s.handleListPots)
+	mux.HandleFunc("PUT /pots/{id}/deposit", s.handleMovePot)
+	mux.HandleFunc("PUT /pots/{id}/withdraw", s.handleMovePot)
+
+	mux.HandleFunc("GET /transactions", s.handleListTransactions)
+	mux.HandleFunc("GET /transactions/{id}", s.handleGetTransaction)
+	mux.HandleFunc("PATCH /transactions/{id}", s.handleAnnotateTransaction)
+
+	mux.HandleFunc("POST /feed", s.handleCreateFeedItem)
+
+	mux.HandleFunc("POST /attachment/upload", s.handleUploadAttachment)
+	mux.HandleFunc("POST /attachment/register", s.handleRegisterAttachment)
+	mux.HandleFunc("POST /attachment/deregister", s.handleDeregisterAttachment)
+	mux.HandleFunc("PUT /_upload/{id}/{name}", s.handleUploadFile)
+	mux.HandleFunc("POST /_upload/{id}/{name}", s.handleUploadFile)
+	mux.HandleFunc("GET /_files/{id}/{name}", s.handleGetFile)
+
+	mux.HandleFunc("PUT /transaction-receipts", s.handleCreateReceipt)
+	mux.HandleFunc("GET /transaction-receipts", s.handleGetReceipt)
+	mux.HandleFunc("DELETE /transaction-receipts", s.handleDeleteReceipt)
+
+	mux.HandleFunc("POST /webhooks", s.handleRegisterWebhook)
+	mux.HandleFunc("GET /webhooks", s.handleListWebhooks)
+	mux.HandleFunc("DELETE /webhooks/{id}", s.handleDeleteWebhook)
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("No endpoint for %s %s", r.Method, r.URL.Path))
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.injectFailure(w, r) {
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// injectFailure writes the first failure queued by FailNext that matches
+// r, or a 401 if the client has logged out. It reports whether it wrote
+// a response.
+func (s *Server) injectFailure(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loggedOut {
+		writeError(w, http.StatusUnauthorized, "unauthorized.bad_access_token", "Access token has been invalidated")
+		return true
+	}
+	for i, f := range s.failures {
+		if (f.method == "" || f.method == r.Method) && f.path == r.URL.Path {
+			s.failures = slices.Delete(s.failures, i, i+1)
+			writeError(w, f.status, f.code, f.message)
+			return true
+		}
+	}
+	return false
+}
+
+// requireParam returns the named query or form value, or writes a 400 and
+// returns false if it is missing.
+func requireParam(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	v := r.FormValue(name)
+	if v == "" {
+		writeError(w, http.StatusBadRequest, "bad_request.missing_param."+name, fmt.Sprintf("Missing required parameter %q", name))
+		return "", false
+	}
+	return v, true
+}
+
+// --- Authentication ---
+
+func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, monzo.WhoAmIResponse{Authenticated: true, ClientID: ClientID, UserID: UserID})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.loggedOut = true
+	s.mu.Unlock()
+	writeJSON(w, struct{}{})
+}
+
+// --- Accounts and balance ---
+
+func (s *Server) handleListAccounts(w http.ResponseWriter, r *http.Request) {
+	accountType := monzo.AccountType(r.FormValue("account_type"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := []monzo.Account{}
+	for _, acc := range s.accounts {
+		if accountType == "" || acc.Type == accountType {
+			accounts = append(accounts, *acc)
+		}
+	}
+	writeJSON(w, monzo.ListAccountsResponse{Accounts: accounts})
+}
+
+// handleGetBalance reports the account's balance. TotalBalance includes
+// the account's pots, and SpendToday sums today's outgoing transactions
+// other than pot transfers.
+func (s *Server) handleGetBalance(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := requireParam(w, r, "account_id")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(accountID)
+	if acc == nil {
+		writeError(w, http.StatusNotFound, "not_found.account", "Account not found")
+		return
+	}
+
+	balance := monzo.Balance{
+		Balance:    s.balances[accountID],
+		Currency:   acc.Currency,
+		LocalSpend: []monzo.LocalSpend{},
+	}
+	balance.TotalBalance = balance.Balance
+	for _, pot := range s.pots {
+		if pot.CurrentAccountID == accountID && !pot.Deleted {
+			balance.TotalBalance += pot.Balance
+		}
+	}
+	balance.BalanceIncludingFlexibleSavings = balance.TotalBalance
+
+	y, m, d := time.Now().UTC().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	for _, tx := range s.transactions {
+		if tx.AccountID == accountID && tx.Amount < 0 && tx.DeclineReason == "" &&
+			tx.Scheme != "uk_retail_pot" && !tx.Created.Before(today) {
+			balance.SpendToday += tx.Amount
+		}
+	}
+	writeJSON(w, balance)
+}
+
+// --- Pots ---
+
+func (s *Server) handleListPots(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := requireParam(w, r, "current_account_id")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.account(accountID) == nil {
+		writeError(w, http.StatusNotFound, "not_found.account", "Account not found")
+		return
+	}
+	pots := []monzo.Pot{}
+	for _, pot := range s.pots {
+		if pot.CurrentAccountID == accountID {
+			pots = append(pots, *pot)
+		}
+	}
+	writeJSON(w, monzo.ListPotsResponse{Pots: pots})
+}
+
+// handleMovePot handles deposits into and withdrawals from a pot. Each
+// move creates a transaction on the account, and a dedupe ID can only be
+// used for one move: repeating a request returns the pot without moving
+// money again.
+func (s *Server) handleMovePot(w http.ResponseWriter, r *http.Request) {
+	deposit := strings.HasSuffix(r.URL.Path, "/deposit")
+	accountParam := "destination_account_id"
+	if deposit {
+		accountParam = "source_account_id"
+	}
+
+	accountID, ok := requireParam(w, r, accountParam)
+	if !ok {
+		return
+	}
+	amountStr, ok := requireParam(w, r, "amount")
+	if !ok {
+		return
+	}
+	dedupeID, ok := requireParam(w, r, "dedupe_id")
+	if !ok {
+		return
+	}
+	amount, err := strconv.ParseInt(amountStr, 10, 64)
+	if err != nil || amount <= 0 {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param.amount", "Amount must be a positive integer")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pot := s.pot(r.PathValue("id"))
+	if pot == nil || pot.Deleted {
+		writeError(w, http.StatusNotFound, "not_found.pot", "Pot not found")
+		return
+	}
+	if accountID != pot.CurrentAccountID {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param."+accountParam, "Account does not own this pot")
+		return
+	}
+
+	request := fmt.Sprintf("%s %s %d", r.URL.Path, accountID, amount)
+	if prev, used := s.potDedupe[dedupeID]; used {
+		if prev != request {
+			writeError(w, http.StatusBadRequest, "bad_request.dedupe_id_reused", "Dedupe ID was already used for a different request")
+			return
+		}
+		writeJSON(w, pot)
+		return
+	}
+
+	txAmount := amount
+	if deposit {
+		if s.balances[accountID] < amount {
+			writeError(w, http.StatusBadRequest, "bad_request.insufficient_funds", "Insufficient funds in account")
+			return
+		}
+		txAmount = -amount
+	} else {
+		if pot.Locked {
+			writeError(w, http.StatusForbidden, "forbidden.pot_locked", "Pot is locked")
+			return
+		}
+		if pot.Balance < amount {
+			writeError(w, http.StatusBadRequest, "bad_request.insufficient_funds", "Insufficient funds in pot")
+			return
+		}
+	}
+
+	s.potDedupe[dedupeID] = request
+	pot.Balance -= txAmount
+	pot.Updated = s.now()
+	s.addTransaction(monzo.Transaction{
+		AccountID:   accountID,
+		Amount:      txAmount,
+		Description: pot.ID,
+		Category:    monzo.CategorySavings,
+		Scheme:      "uk_retail_pot",
+		DedupeID:    dedupeID,
+		Metadata:    map[string]string{"pot_id": pot.ID},
+		Settled:     monzo.NullableTime{Time: pot.Updated},
+	})
+	writeJSON(w, pot)
+}
+
+// --- Transactions ---
+
+// handleListTransactions returns a page of an account's transactions,
+// oldest first. since may be an RFC 3339 time (inclusive) or a
+// transaction ID (exclusive); before is an RFC 3339 time (exclusive).
+func (s *Server) handleListTransactions(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := requireParam(w, r, "account_id")
+	if !ok {
+		return
+	}
+	limit := maxPageSize
+	if v := r.FormValue("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			writeError(w, http.StatusBadRequest, "bad_request.bad_param.limit", "Limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+	var before time.Time
+	if v := r.FormValue("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request.bad_param.before", "Before must be an RFC 3339 time")
+			return
+		}
+		before = t
+	}
+	expand := r.Form["expand[]"]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.account(accountID) == nil {
+		writeError(w, http.StatusNotFound, "not_found.account", "Account not found")
+		return
+	}
+
+	var txs []*monzo.Transaction
+	for _, tx := range s.transactions {
+		if tx.AccountID == accountID {
+			txs = append(txs, tx)
+		}
+	}
+
+	if since := r.FormValue("since"); since != "" {
+		if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+			txs = slices.DeleteFunc(txs, func(tx *monzo.Transaction) bool { return tx.Created.Before(t) })
+		} else {
+			i := slices.IndexFunc(txs, func(tx *monzo.Transaction) bool { return tx.ID == since })
+			if i < 0 {
+				writeError(w, http.StatusBadRequest, "bad_request.bad_param.since", "Since must be an RFC 3339 time or a transaction ID")
+				return
+			}
+			txs = txs[i+1:]
+		}
+	}
+	if !before.IsZero() {
+		txs = slices.DeleteFunc(txs, func(tx *monzo.Transaction) bool { return !tx.Created.Before(before) })
+	}
+	if len(txs) > limit {
+		txs = txs[:limit]
+	}
+
+	page := make([]monzo.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		page = append(page, s.render(tx, expand))
+	}
+	writeJSON(w, monzo.ListTransactionsResponse{Transactions: page})
+}
+
+func (s *Server) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.transaction(r.PathValue("id"))
+	if tx == nil {
+		writeError(w, http.StatusNotFound, "not_found.transaction", "Transaction not found")
+		return
+	}
+	writeJSON(w, monzo.GetTransactionResponse{Transaction: s.render(tx, r.Form["expand[]"])})
+}
+
+// handleAnnotateTransaction sets metadata[key] form values on a
+// transaction. An empty value deletes the key, and metadata[notes] also
+// sets the transaction's notes.
+func (s *Server) handleAnnotateTransaction(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.transaction(r.PathValue("id"))
+	if tx == nil {
+		writeError(w, http.StatusNotFound, "not_found.transaction", "Transaction not found")
+		return
+	}
+	for name, values := range r.PostForm {
+		key, ok := strings.CutPrefix(name, "metadata[")
+		if !ok || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		key = strings.TrimSuffix(key, "]")
+		value := values[len(values)-1]
+		if value == "" {
+			delete(tx.Metadata, key)
+		} else {
+			tx.Metadata[key] = value
+		}
+		if key == "notes" {
+			tx.Notes = value
+		}
+	}
+	tx.Updated = monzo.NullableTime{Time: s.now()}
+	writeJSON(w, monzo.GetTransactionResponse{Transaction: s.render(tx, nil)})
+}
+
+// render returns a copy of tx for a response, with its merchant expanded
+// if asked for and known. s.mu must be held.
+func (s *Server) render(tx *monzo.Transaction, expand []string) monzo.Transaction {
+	out := *tx
+	if !slices.Contains(expand, "merchant") {
+		return out
+	}
+	if id, ok := tx.MerchantID(); ok {
+		if m, known := s.merchants[id]; known {
+			out.Merchant, _ = json.Marshal(m)
+		}
+	}
+	return out
+}
+
+// --- Feed ---
+
+func (s *Server) handleCreateFeedItem(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := requireParam(w, r, "account_id")
+	if !ok {
+		return
+	}
+	if r.FormValue("type") != "basic" {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param.type", `Feed item type must be "basic"`)
+		return
+	}
+	params := map[string]string{}
+	for name, values := range r.PostForm {
+		if key, ok := strings.CutPrefix(name, "params["); ok && strings.HasSuffix(key, "]") {
+			params[strings.TrimSuffix(key, "]")] = values[len(values)-1]
+		}
+	}
+	for _, required := range []string{"title", "image_url"} {
+		if params[required] == "" {
+			writeError(w, http.StatusBadRequest, "bad_request.missing_param.params."+required, fmt.Sprintf("Missing required parameter params[%s]", required))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.account(accountID) == nil {
+		writeError(w, http.StatusNotFound, "not_found.account", "Account not found")
+		return
+	}
+	s.feed = append(s.feed, FeedItem{
+		AccountID: accountID,
+		Type:      "basic",
+		URL:       r.FormValue("url"),
+		Params:    params,
+		Created:   s.now(),
+	})
+	writeJSON(w, struct{}{})
+}
+
+// --- Attachments ---
+
+// handleUploadAttachment returns URLs on the fake server itself, so the
+// file can really be uploaded and fetched back.
+func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	fileName, ok := requireParam(w, r, "file_name")
+	if !ok {
+		return
+	}
+	if _, ok := requireParam(w, r, "file_type"); !ok {
+		return
+	}
+
+	s.mu.Lock()
+	id := s.newID("upload")
+	s.mu.Unlock()
+
+	name := fileName[strings.LastIndex(fileName, "/")+1:]
+	writeJSON(w, monzo.UploadAttachmentResponse{
+		FileURL:   fmt.Sprintf("%s/_files/%s/%s", s.URL(), id, name),
+		UploadURL: fmt.Sprintf("%s/_upload/%s/%s", s.URL(), id, name),
+	})
+}
+
+func (s *Server) handleUploadFile(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.files[fmt.Sprintf("/_files/%s/%s", r.PathValue("id"), r.PathValue("name"))] = data
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleGetFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.files[r.URL.Path]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found.file", "File not found")
+		return
+	}
+	w.Write(data)
+}
+
+// UploadedFile returns the contents of a file uploaded to an UploadURL,
+// given its FileURL.
+func (s *Server) UploadedFile(fileURL string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[strings.TrimPrefix(fileURL, s.URL())]
+	return data, ok
+}
+
+func (s *Server) handleRegisterAttachment(w http.ResponseWriter, r *http.Request) {
+	externalID, ok := requireParam(w, r, "external_id")
+	if !ok {
+		return
+	}
+	fileURL, ok := requireParam(w, r, "file_url")
+	if !ok {
+		return
+	}
+	fileType, ok := requireParam(w, r, "file_type")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.transaction(externalID)
+	if tx == nil {
+		writeError(w, http.StatusNotFound, "not_found.transaction", "Transaction not found")
+		return
+	}
+	attachment := &monzo.Attachment{
+		ID:         s.newID("attach"),
+		UserID:     UserID,
+		ExternalID: externalID,
+		FileURL:    fileURL,
+		FileType:   fileType,
+		Created:    s.now(),
+	}
+	s.attachments[attachment.ID] = attachment
+	tx.Attachments = append(tx.Attachments, *attachment)
+	writeJSON(w, monzo.RegisterAttachmentResponse{Attachment: *attachment})
+}
+
+func (s *Server) handleDeregisterAttachment(w http.ResponseWriter, r *http.Request) {
+	id, ok := requireParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attachment, ok := s.attachments[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found.attachment", "Attachment not found")
+		return
+	}
+	delete(s.attachments, id)
+	if tx := s.transaction(attachment.ExternalID); tx != nil {
+		tx.Attachments = slices.DeleteFunc(tx.Attachments, func(a monzo.Attachment) bool { return a.ID == id })
+	}
+	writeJSON(w, struct{}{})
+}
+
+// --- Receipts ---
+
+// handleCreateReceipt creates or replaces the receipt with the request's
+// external ID.
+func (s *Server) handleCreateReceipt(w http.ResponseWriter, r *http.Request) {
+	var receipt monzo.Receipt
+	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request.invalid_json", err.Error())
+		return
+	}
+	if receipt.ExternalID == "" {
+		writeError(w, http.StatusBadRequest, "bad_request.missing_param.external_id", `Missing required parameter "external_id"`)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.transaction(receipt.TransactionID) == nil {
+		writeError(w, http.StatusNotFound, "not_found.transaction", "Transaction not found")
+		return
+	}
+	if prev, ok := s.receipts[receipt.ExternalID]; ok {
+		receipt.ID = prev.ID
+	} else {
+		receipt.ID = s.newID("receipt")
+	}
+	s.receipts[receipt.ExternalID] = &receipt
+	writeJSON(w, receipt)
+}
+
+func (s *Server) handleGetReceipt(w http.ResponseWriter, r *http.Request) {
+	externalID, ok := requireParam(w, r, "external_id")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt, ok := s.receipts[externalID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found.receipt", "Receipt not found")
+		return
+	}
+	writeJSON(w, monzo.GetReceiptResponse{Receipt: *receipt})
+}
+
+func (s *Server) handleDeleteReceipt(w http.ResponseWriter, r *http.Request) {
+	externalID, ok := requireParam(w, r, "external_id")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.receipts[externalID]; !ok {
+		writeError(w, http.StatusNotFound, "not_found.receipt", "Receipt not found")
+		return
+	}
+	delete(s.receipts, externalID)
+	writeJSON(w, struct{}{})
+}
+
+// --- Webhooks ---
+
+func (s *Server) handleRegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := requireParam(w, r, "account_id")
+	if !ok {
+		return
+	}
+	webhookURL, ok := requireParam(w, r, "url")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.account(accountID) == nil {
+		writeError(w, http.StatusNotFound, "not_found.account", "Account not found")
+		return
+	}
+	webhook := monzo.Webhook{ID: s.newID("webhook"), AccountID: accountID, URL: webhookURL}
+	s.webhooks = append(s.webhooks, webhook)
+	writeJSON(w, monzo.RegisterWebhookResponse{Webhook: webhook})
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := requireParam(w, r, "account_id")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := []monzo.Webhook{}
+	for _, webhook := range s.webhooks {
+		if webhook.AccountID == accountID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	writeJSON(w, monzo.ListWebhooksResponse{Webhooks: webhooks})
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	i := slices.IndexFunc(s.webhooks, func(webhook monzo.Webhook) bool { return webhook.ID == id })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "not_found.webhook", "Webhook not found")
+		return
+	}
+	s.webhooks = slices.Delete(s.webhooks, i, i+1)
+	writeJSON(w, struct{}{})
+}
@@ -0,0 +1,440 @@
+// Package monzotest provides an in-process fake of the Monzo API for
+// testing code that uses the monzo package.
+//
+// The fake is stateful: depositing into a pot really moves money out of
+// the account, transactions page like the real API, and receipts,
+// attachments, webhooks and feed items are stored and can be inspected.
+// Errors use Monzo's JSON error format, so they match the monzo package's
+// sentinel errors.
+//
+//	func TestSaveSpareChange(t *testing.T) {
+//		srv, client := monzotest.New(t)
+//		acc := srv.AddAccount(monzo.Account{Description: "Current account"}, 10_00)
+//		pot := srv.AddPot(acc.ID, monzo.Pot{Name: "Savings"})
+//
+//		if err := SaveSpareChange(ctx, client, acc.ID, pot.ID); err != nil {
+//			t.Fatal(err)
+//		}
+//		if got := srv.Balance(acc.ID); got != 0 {
+//			t.Errorf("expected an empty account, got %d", got)
+//		}
+//	}
+package monzotest
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+	"github.com/petermakeswebsites/go-monzo/monzotest/webhooktest"
+)
+
+// Default identity reported by /ping/whoami. UserID is also the user of
+// webhook scenario transactions.
+const (
+	UserID   = webhooktest.UserID
+	ClientID = "oauth2client_test"
+)
+
+// FeedItem is a feed item created through the API.
+type FeedItem struct {
+	AccountID string
+	Type      string
+	URL       string
+	Params    map[string]string
+	Created   time.Time
+}
+
+// Server is a fake Monzo API. Create one with New. Its methods seed and
+// inspect its state, and are safe to call while requests are being served.
+type Server struct {
+	srv *httptest.Server
+
+	mu           sync.Mutex
+	lastID       int
+	lastTime     time.Time
+	loggedOut    bool
+	accounts     []*monzo.Account
+	balances     map[string]int64 // by account ID, excluding pots
+	pots         []*monzo.Pot
+	potDedupe    map[string]string // dedupe ID to the request it was used for
+	transactions []*monzo.Transaction
+	merchants    map[string]monzo.Merchant
+	attachments  map[string]*monzo.Attachment
+	files        map[string][]byte // uploaded attachment files, by path
+	receipts     map[string]*monzo.Receipt
+	webhooks     []monzo.Webhook
+	feed         []FeedItem
+	failures     []failure
+}
+
+// failure is an error queued by FailNext.
+type failure struct {
+	method, path  string
+	status        int
+	code, message string
+}
+
+// New starts a fake Monzo API, and returns it with a client pointed at it.
+// opts are passed to monzo.NewClient after the base URL, so they may add
+// to or override the client's configuration. The server is closed when
+// the test finishes.
+func New(tb testing.TB, opts ...monzo.Option) (*Server, *monzo.Client) {
+	tb.Helper()
+
+	s := &Server{
+		balances:    make(map[string]int64),
+		potDedupe:   make(map[string]string),
+		merchants:   make(map[string]monzo.Merchant),
+		attachments: make(map[string]*monzo.Attachment),
+		files:       make(map[string][]byte),
+		receipts:    make(map[string]*monzo.Receipt),
+	}
+	s.srv = httptest.NewServer(s.routes())
+	tb.Cleanup(s.srv.Close)
+
+	opts = append([]monzo.Option{monzo.WithBaseURL(s.srv.URL)}, opts...)
+	return s, monzo.NewClient(s.srv.Client(), opts...)
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// newID returns a new unique ID with the given prefix, e.g. "acc_00001".
+// s.mu must be held.
+func (s *Server) newID(prefix string) string {
+	s.lastID++
+	return fmt.Sprintf("%s_%05d", prefix, s.lastID)
+}
+
+// now returns the current time, always later than the last time it
+// returned, so that objects created in a row are strictly ordered.
+// s.mu must be held.
+func (s *Server) now() time.Time {
+	t := time.Now().UTC()
+	if !t.After(s.lastTime) {
+		t = s.lastTime.Add(time.Millisecond)
+	}
+	s.lastTime = t
+	return t
+}
+
+// FailNext makes the next request matching method and path fail with the
+// given status and Monzo error code, e.g.
+//
+//	srv.FailNext(http.MethodGet, "/balance", http.StatusTooManyRequests, "too_many_requests", "Slow down")
+//
+// An empty method matches any method. Failures are used up in the order
+// they were queued.
+func (s *Server) FailNext(method, path string, status int, code, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{method, path, status, code, message})
+}
+
+// AddAccount adds an account holding balance, in minor units. Missing
+// fields are filled in: ID, Created, Type (uk_retail), ProductType
+// (standard), Currency (GBP), CountryCode (GB) and Owners.
+func (s *Server) AddAccount(acc monzo.Account, balance int64) monzo.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if acc.ID == "" {
+		acc.ID = s.newID("acc")
+	}
+	if acc.Created.IsZero() {
+		acc.Created = s.now()
+	}
+	acc.Type = cmp.Or(acc.Type, monzo.AccountTypeUKRetail)
+	acc.ProductType = cmp.Or(acc.ProductType, monzo.ProductTypeStandard)
+	acc.Currency = cmp.Or(acc.Currency, "GBP")
+	acc.CountryCode = cmp.Or(acc.CountryCode, "GB")
+	if len(acc.Owners) == 0 {
+		acc.Owners = []monzo.AccountOwner{{UserID: UserID}}
+	}
+
+	stored := cloneAccount(acc)
+	s.accounts = append(s.accounts, &stored)
+	s.balances[acc.ID] = balance
+	return acc
+}
+
+// CloseAccount marks an account as closed.
+func (s *Server) CloseAccount(accountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if acc := s.account(accountID); acc != nil {
+		acc.Closed = true
+	}
+}
+
+// SetBalance sets the balance of an account, excluding its pots.
+func (s *Server) SetBalance(accountID string, balance int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances[accountID] = balance
+}
+
+// Balance returns the balance of an account, excluding its pots.
+func (s *Server) Balance(accountID string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balances[accountID]
+}
+
+// AddPot adds a pot to an account. Missing fields are filled in: ID,
+// Created, Updated, Currency (the account's), Style (beach_ball) and Type
+// (default).
+func (s *Server) AddPot(accountID string, pot monzo.Pot) monzo.Pot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pot.ID == "" {
+		pot.ID = s.newID("pot")
+	}
+	if pot.Created.IsZero() {
+		pot.Created = s.now()
+	}
+	if pot.Updated.IsZero() {
+		pot.Updated = pot.Created
+	}
+	pot.CurrentAccountID = accountID
+	if acc := s.account(accountID); acc != nil {
+		pot.Currency = cmp.Or(pot.Currency, acc.Currency)
+	}
+	pot.Currency = cmp.Or(pot.Currency, "GBP")
+	pot.Style = cmp.Or(pot.Style, monzo.PotStyleBeachBall)
+	pot.Type = cmp.Or(pot.Type, "default")
+
+	s.pots = append(s.pots, &pot)
+	return pot
+}
+
+// Pot returns a pot by ID.
+func (s *Server) Pot(potID string) (monzo.Pot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pot := s.pot(potID); pot != nil {
+		return *pot, true
+	}
+	return monzo.Pot{}, false
+}
+
+// AddMerchant adds a merchant, which transactions can refer to by ID and
+// which is returned when merchants are expanded.
+func (s *Server) AddMerchant(m monzo.Merchant) monzo.Merchant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m.ID == "" {
+		m.ID = s.newID("merch")
+	}
+	if m.Created.IsZero() {
+		m.Created = s.now()
+	}
+	s.merchants[m.ID] = m
+	return m
+}
+
+// AddTransaction adds a transaction to an account and adjusts its balance
+// by the amount, unless the transaction was declined. Missing fields are
+// filled in: ID, Created, Currency, LocalAmount, LocalCurrency, UserID and
+// Category (general). Transactions are listed in order of Created.
+func (s *Server) AddTransaction(tx monzo.Transaction) monzo.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addTransaction(tx)
+}
+
+// addTransaction implements AddTransaction. s.mu must be held.
+func (s *Server) addTransaction(tx monzo.Transaction) monzo.Transaction {
+	if tx.ID == "" {
+		tx.ID = s.newID("tx")
+	}
+	if tx.Created.IsZero() {
+		tx.Created = s.now()
+	}
+	if acc := s.account(tx.AccountID); acc != nil {
+		tx.Currency = cmp.Or(tx.Currency, acc.Currency)
+	}
+	tx.Currency = cmp.Or(tx.Currency, "GBP")
+	if tx.LocalCurrency == "" {
+		tx.LocalAmount = tx.Amount
+		tx.LocalCurrency = tx.Currency
+	}
+	tx.UserID = cmp.Or(tx.UserID, UserID)
+	tx.Category = cmp.Or(tx.Category, monzo.CategoryGeneral)
+	if tx.Metadata == nil {
+		tx.Metadata = map[string]string{}
+	}
+	if tx.DeclineReason == "" {
+		s.balances[tx.AccountID] += tx.Amount
+	}
+
+	stored := cloneTransaction(tx)
+	s.transactions = append(s.transactions, &stored)
+	slices.SortStableFunc(s.transactions, func(a, b *monzo.Transaction) int {
+		return a.Created.Compare(b.Created)
+	})
+	return tx
+}
+
+// Transactions returns the transactions of an account, oldest first.
+func (s *Server) Transactions(accountID string) []monzo.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var txs []monzo.Transaction
+	for _, tx := range s.transactions {
+		if tx.AccountID == accountID {
+			txs = append(txs, cloneTransaction(*tx))
+		}
+	}
+	return txs
+}
+
+// Receipt returns a receipt by its external ID.
+func (s *Server) Receipt(externalID string) (monzo.Receipt, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.receipts[externalID]; ok {
+		return cloneReceipt(*r), true
+	}
+	return monzo.Receipt{}, false
+}
+
+// Webhooks returns the webhooks registered for an account.
+func (s *Server) Webhooks(accountID string) []monzo.Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var webhooks []monzo.Webhook
+	for _, w := range s.webhooks {
+		if w.AccountID == accountID {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks
+}
+
+// FeedItems returns the feed items created for an account.
+func (s *Server) FeedItems(accountID string) []FeedItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []FeedItem
+	for _, item := range s.feed {
+		if item.AccountID == accountID {
+			item.Params = maps.Clone(item.Params)
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// LoggedOut reports whether the client has logged out. Once it has, every
+// request fails with 401.
+func (s *Server) LoggedOut() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loggedOut
+}
+
+// account returns the account with the given ID, or nil. s.mu must be held.
+func (s *Server) account(id string) *monzo.Account {
+	for _, acc := range s.accounts {
+		if acc.ID == id {
+			return acc
+		}
+	}
+	return nil
+}
+
+// pot returns the pot with the given ID, or nil. s.mu must be held.
+func (s *Server) pot(id string) *monzo.Pot {
+	for _, pot := range s.pots {
+		if pot.ID == id {
+			return pot
+		}
+	}
+	return nil
+}
+
+// transaction returns the transaction with the given ID, or nil.
+// s.mu must be held.
+func (s *Server) transaction(id string) *monzo.Transaction {
+	for _, tx := range s.transactions {
+		if tx.ID == id {
+			return tx
+		}
+	}
+	return nil
+}
+
+// The Server's state is only changed with s.mu held, so values passed in
+// and handed out must not share maps or slices with it. The clone
+// functions below copy them deeply.
+
+// cloneAccount returns a deep copy of acc.
+func cloneAccount(acc monzo.Account) monzo.Account {
+	acc.Owners = slices.Clone(acc.Owners)
+	return acc
+}
+
+// cloneTransaction returns a deep copy of tx.
+func cloneTransaction(tx monzo.Transaction) monzo.Transaction {
+	tx.Merchant = bytes.Clone(tx.Merchant)
+	tx.Metadata = maps.Clone(tx.Metadata)
+	tx.Attachments = slices.Clone(tx.Attachments)
+	tx.Categories = maps.Clone(tx.Categories)
+	if tx.Counterparty != nil {
+		counterparty := *tx.Counterparty
+		tx.Counterparty = &counterparty
+	}
+	return tx
+}
+
+// cloneReceipt returns a deep copy of r.
+func cloneReceipt(r monzo.Receipt) monzo.Receipt {
+	r.Items = cloneReceiptItems(r.Items)
+	r.Taxes = slices.Clone(r.Taxes)
+	r.Payments = slices.Clone(r.Payments)
+	if r.Merchant != nil {
+		merchant := *r.Merchant
+		r.Merchant = &merchant
+	}
+	return r
+}
+
+// cloneReceiptItems returns a deep copy of items, including sub-items.
+func cloneReceiptItems(items []monzo.ReceiptItem) []monzo.ReceiptItem {
+	items = slices.Clone(items)
+	for i := range items {
+		items[i].SubItems = cloneReceiptItems(items[i].SubItems)
+	}
+	return items
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in Monzo's JSON error format.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": message})
+}
@@ -0,0 +1,266 @@
+package monzotest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+)
+
+func TestAccountsAndBalance(t *testing.T) {
+	srv, client := New(t)
+	ctx := context.Background()
+
+	acc := srv.AddAccount(monzo.Account{Description: "Current account"}, 100_00)
+	srv.AddAccount(monzo.Account{Type: monzo.AccountTypeUKRetailJoint}, 0)
+	srv.AddPot(acc.ID, monzo.Pot{Name: "Savings", Balance: 50_00})
+	srv.AddTransaction(monzo.Transaction{AccountID: acc.ID, Amount: -12_34, Description: "Coffee"})
+
+	accounts, err := client.ListAccounts(ctx, monzo.AccountTypeUKRetail)
+	if err != nil {
+		t.Fatalf("ListAccounts returned an error: %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].ID != acc.ID || accounts[0].Currency != "GBP" {
+		t.Errorf("unexpected accounts: %+v", accounts)
+	}
+
+	balance, err := client.GetBalance(ctx, acc.ID)
+	if err != nil {
+		t.Fatalf("GetBalance returned an error: %v", err)
+	}
+	if balance.Balance != 87_66 || balance.TotalBalance != 137_66 || balance.SpendToday != -12_34 {
+		t.Errorf("unexpected balance: %+v", balance)
+	}
+
+	if _, err := client.GetBalance(ctx, "acc_missing"); !errors.Is(err, monzo.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPotDepositAndWithdraw(t *testing.T) {
+	srv, client := New(t)
+	ctx := context.Background()
+
+	acc := srv.AddAccount(monzo.Account{}, 100_00)
+	pot := srv.AddPot(acc.ID, monzo.Pot{Name: "Holiday"})
+
+	got, err := client.DepositToPot(ctx, pot.ID, acc.ID, "dedupe-1", 30_00)
+	if err != nil {
+		t.Fatalf("DepositToPot returned an error: %v", err)
+	}
+	if got.Balance != 30_00 || srv.Balance(acc.ID) != 70_00 {
+		t.Errorf("expected pot 3000 and account 7000, got %d and %d", got.Balance, srv.Balance(acc.ID))
+	}
+
+	// Repeating the request with the same dedupe ID doesn't move money again.
+	if got, err = client.DepositToPot(ctx, pot.ID, acc.ID, "dedupe-1", 30_00); err != nil || got.Balance != 30_00 {
+		t.Errorf("expected repeated deposit to be ignored, got %+v, %v", got, err)
+	}
+	if _, err := client.DepositToPot(ctx, pot.ID, acc.ID, "dedupe-1", 10_00); !errors.Is(err, monzo.ErrBadRequest) {
+		t.Errorf("expected ErrBadRequest for a reused dedupe ID, got %v", err)
+	}
+	if _, err := client.DepositToPot(ctx, pot.ID, acc.ID, "dedupe-2", 1000_00); !errors.Is(err, monzo.ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+
+	if got, err = client.WithdrawFromPot(ctx, pot.ID, acc.ID, "dedupe-3", 5_00); err != nil || got.Balance != 25_00 {
+		t.Errorf("expected pot balance 2500, got %+v, %v", got, err)
+	}
+	if _, err := client.WithdrawFromPot(ctx, pot.ID, acc.ID, "dedupe-4", 100_00); !errors.Is(err, monzo.ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+
+	txs := srv.Transactions(acc.ID)
+	if len(txs) != 2 || txs[0].Amount != -30_00 || txs[1].Amount != 5_00 || txs[0].DedupeID != "dedupe-1" {
+		t.Errorf("expected a transaction for each move, got %+v", txs)
+	}
+	if srv.Balance(acc.ID) != 75_00 {
+		t.Errorf("expected account balance 7500, got %d", srv.Balance(acc.ID))
+	}
+}
+
+func TestTransactionPagination(t *testing.T) {
+	srv, client := New(t)
+	ctx := context.Background()
+
+	acc := srv.AddAccount(monzo.Account{}, 0)
+	for range 250 {
+		srv.AddTransaction(monzo.Transaction{AccountID: acc.ID, Amount: 1})
+	}
+
+	txs, err := monzo.All(client.Transactions(ctx, acc.ID, nil))
+	if err != nil {
+		t.Fatalf("Transactions returned an error: %v", err)
+	}
+	if len(txs) != 250 {
+		t.Errorf("expected 250 transactions, got %d", len(txs))
+	}
+
+	page, err := client.ListTransactions(ctx, acc.ID, &monzo.PaginationOptions{Limit: 10, Since: txs[99].ID})
+	if err != nil {
+		t.Fatalf("ListTransactions returned an error: %v", err)
+	}
+	if len(page) != 10 || page[0].ID != txs[100].ID {
+		t.Errorf("expected 10 transactions starting after %s, got %d starting at %s", txs[99].ID, len(page), page[0].ID)
+	}
+}
+
+func TestTransactionAnnotationAndMerchant(t *testing.T) {
+	srv, client := New(t)
+	ctx := context.Background()
+
+	acc := srv.AddAccount(monzo.Account{}, 0)
+	merchant := srv.AddMerchant(monzo.Merchant{Name: "Ozone Coffee Roasters", Category: monzo.CategoryEatingOut})
+	tx := srv.AddTransaction(monzo.Transaction{AccountID: acc.ID, Amount: -350, Merchant: []byte(`"` + merchant.ID + `"`)})
+
+	got, err := client.GetTransaction(ctx, tx.ID, true)
+	if err != nil {
+		t.Fatalf("GetTransaction returned an error: %v", err)
+	}
+	if m, ok := got.ExpandedMerchant(); !ok || m.Name != "Ozone Coffee Roasters" {
+		t.Errorf("expected expanded merchant, got %s", got.Merchant)
+	}
+
+	got, err = client.AnnotateTransaction(ctx, tx.ID, map[string]string{"notes": "flat white", "trip": "london"})
+	if err != nil {
+		t.Fatalf("AnnotateTransaction returned an error: %v", err)
+	}
+	if got.Notes != "flat white" || got.Metadata["trip"] != "london" || !got.Updated.Valid() {
+		t.Errorf("unexpected annotated transaction: %+v", got)
+	}
+	if got, _ = client.AnnotateTransaction(ctx, tx.ID, map[string]string{"trip": ""}); got.Metadata["trip"] != "" {
+		t.Errorf("expected metadata to be deleted, got %v", got.Metadata)
+	}
+}
+
+func TestStateIsCopied(t *testing.T) {
+	srv, client := New(t)
+	ctx := context.Background()
+
+	metadata := map[string]string{"trip": "london"}
+	owners := []monzo.AccountOwner{{UserID: "user_001"}}
+	acc := srv.AddAccount(monzo.Account{Owners: owners}, 0)
+	tx := srv.AddTransaction(monzo.Transaction{AccountID: acc.ID, Metadata: metadata})
+
+	// Changing what was passed in or handed out, even while requests are
+	// served, doesn't touch the server's state.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 20 {
+			client.AnnotateTransaction(ctx, tx.ID, map[string]string{"trip": "paris"})
+			client.ListAccounts(ctx, "")
+		}
+	}()
+	for range 20 {
+		metadata["trip"] = "rome"
+		owners[0].UserID = "user_666"
+		tx.Metadata["trip"] = "rome"
+		acc.Owners[0].UserID = "user_666"
+		for _, got := range srv.Transactions(acc.ID) {
+			got.Metadata["trip"] = "rome"
+		}
+	}
+	<-done
+
+	if got := srv.Transactions(acc.ID)[0].Metadata["trip"]; got != "paris" {
+		t.Errorf("expected the annotation to be kept, got %q", got)
+	}
+	accounts, err := client.ListAccounts(ctx, "")
+	if err != nil {
+		t.Fatalf("ListAccounts returned an error: %v", err)
+	}
+	if accounts[0].Owners[0].UserID != "user_001" {
+		t.Errorf("expected the owner to be unchanged, got %s", accounts[0].Owners[0].UserID)
+	}
+}
+
+func TestReceiptsAttachmentsWebhooksAndFeed(t *testing.T) {
+	srv, client := New(t)
+	ctx := context.Background()
+
+	acc := srv.AddAccount(monzo.Account{}, 0)
+	tx := srv.AddTransaction(monzo.Transaction{AccountID: acc.ID, Amount: -1000})
+
+	receipt := &monzo.Receipt{TransactionID: tx.ID, ExternalID: "order-1", Total: 1000, Currency: "GBP",
+		Items: []monzo.ReceiptItem{{Description: "Book", Amount: 1000, Currency: "GBP"}}}
+	if _, err := client.CreateReceipt(ctx, receipt); err != nil {
+		t.Fatalf("CreateReceipt returned an error: %v", err)
+	}
+	if got, err := client.GetReceipt(ctx, "order-1"); err != nil || got.Items[0].Description != "Book" {
+		t.Errorf("unexpected receipt: %+v, %v", got, err)
+	}
+	if err := client.DeleteReceipt(ctx, "order-1"); err != nil {
+		t.Fatalf("DeleteReceipt returned an error: %v", err)
+	}
+	if _, err := client.GetReceipt(ctx, "order-1"); !errors.Is(err, monzo.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	upload, err := client.UploadAttachment(ctx, "receipt.png", "image/png", 4)
+	if err != nil {
+		t.Fatalf("UploadAttachment returned an error: %v", err)
+	}
+	resp, err := http.Post(upload.UploadURL, "image/png", bytes.NewReader([]byte("\x89PNG")))
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	resp.Body.Close()
+	if data, ok := srv.UploadedFile(upload.FileURL); !ok || string(data) != "\x89PNG" {
+		t.Errorf("expected uploaded file, got %q", data)
+	}
+	attachment, err := client.RegisterAttachment(ctx, tx.ID, upload.FileURL, "image/png")
+	if err != nil {
+		t.Fatalf("RegisterAttachment returned an error: %v", err)
+	}
+	if got := srv.Transactions(acc.ID)[0]; len(got.Attachments) != 1 {
+		t.Errorf("expected 1 attachment, got %d", len(got.Attachments))
+	}
+	if err := client.DeregisterAttachment(ctx, attachment.ID); err != nil {
+		t.Fatalf("DeregisterAttachment returned an error: %v", err)
+	}
+
+	if _, err := client.EnsureWebhook(ctx, acc.ID, "https://example.com/hook"); err != nil {
+		t.Fatalf("EnsureWebhook returned an error: %v", err)
+	}
+	if _, err := client.EnsureWebhook(ctx, acc.ID, "https://example.com/hook"); err != nil {
+		t.Fatalf("EnsureWebhook returned an error: %v", err)
+	}
+	if got := srv.Webhooks(acc.ID); len(got) != 1 {
+		t.Errorf("expected 1 webhook, got %d", len(got))
+	}
+
+	err = client.CreateFeedItem(ctx, acc.ID, "basic", "", map[string]string{"title": "Hello", "image_url": "https://example.com/i.png"})
+	if err != nil {
+		t.Fatalf("CreateFeedItem returned an error: %v", err)
+	}
+	if err := client.CreateFeedItem(ctx, acc.ID, "basic", "", map[string]string{"title": "No image"}); !errors.Is(err, monzo.ErrBadRequest) {
+		t.Errorf("expected ErrBadRequest, got %v", err)
+	}
+	if items := srv.FeedItems(acc.ID); len(items) != 1 || items[0].Params["title"] != "Hello" {
+		t.Errorf("unexpected feed items: %+v", items)
+	}
+}
+
+func TestFailNextAndLogout(t *testing.T) {
+	srv, client := New(t, monzo.WithRetryPolicy(monzo.NoRetries))
+	ctx := context.Background()
+
+	srv.FailNext(http.MethodGet, "/ping/whoami", http.StatusForbidden, "forbidden.insufficient_permissions", "Approve access in the app")
+	if _, err := client.WhoAmI(ctx); !errors.Is(err, monzo.ErrInsufficientPermissions) {
+		t.Errorf("expected ErrInsufficientPermissions, got %v", err)
+	}
+	if who, err := client.WhoAmI(ctx); err != nil || who.UserID != UserID {
+		t.Errorf("expected the failure to be used up, got %+v, %v", who, err)
+	}
+
+	if err := client.Logout(ctx); err != nil {
+		t.Fatalf("Logout returned an error: %v", err)
+	}
+	if _, err := client.WhoAmI(ctx); !errors.Is(err, monzo.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized after logout, got %v", err)
+	}
+}
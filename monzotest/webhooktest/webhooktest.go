@@ -0,0 +1,360 @@
+// Package webhooktest builds realistic Monzo webhook events and delivers
+// them to a handler or URL, to test webhook receivers.
+//
+// Unlike monzotest, it doesn't depend on the testing package, so programs
+// such as command-line tools can use it to send test webhooks:
+//
+//	event, err := webhooktest.WebhookEventFor(webhooktest.ScenarioRefund, "acc_001")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	deliveries, err := webhooktest.SendWebhooks(ctx, "http://localhost:8080/monzo-webhook",
+//		[]*monzo.WebhookEvent{event}, webhooktest.WithRedeliveries(1))
+package webhooktest
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+)
+
+// UserID is the user ID put in scenario transactions. It matches
+// monzotest.UserID.
+const UserID = "user_test"
+
+// Scenario names a realistic webhook event, for WebhookEventFor.
+type Scenario string
+
+// Known scenarios.
+const (
+	// ScenarioCardPayment is a card payment at a coffee shop.
+	ScenarioCardPayment Scenario = "card-payment"
+	// ScenarioRefund is a refund from an online shop to the card.
+	ScenarioRefund Scenario = "refund"
+	// ScenarioDeclined is a card payment declined for insufficient funds.
+	ScenarioDeclined Scenario = "declined"
+	// ScenarioFasterPaymentIn is an incoming UK bank transfer.
+	ScenarioFasterPaymentIn Scenario = "faster-payment-in"
+)
+
+// Scenarios returns every known scenario.
+func Scenarios() []Scenario {
+	return []Scenario{ScenarioCardPayment, ScenarioRefund, ScenarioDeclined, ScenarioFasterPaymentIn}
+}
+
+// ScenarioTransaction returns a new transaction for a scenario, with a
+// unique ID, on the given account. It is what Monzo would send in the
+// transaction.created webhook: merchants are expanded and unsettled
+// transactions have an empty settled time.
+func ScenarioTransaction(scenario Scenario, accountID string) (monzo.Transaction, error) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	tx := monzo.Transaction{
+		ID:                randomID("tx"),
+		AccountID:         accountID,
+		UserID:            UserID,
+		Created:           now,
+		Updated:           monzo.NullableTime{Time: now},
+		Currency:          "GBP",
+		LocalCurrency:     "GBP",
+		Metadata:          map[string]string{},
+		IncludeInSpending: true,
+	}
+
+	switch scenario {
+	case ScenarioCardPayment:
+		tx.Amount = -350
+		tx.Description = "OZONE COFFEE ROASTERS LONDON GBR"
+		tx.Category = monzo.CategoryEatingOut
+		tx.Scheme = "mastercard"
+		tx.AmountIsPending = true
+		tx.Originator = true
+		tx.Merchant = scenarioMerchant("Ozone Coffee Roasters", monzo.CategoryEatingOut, "☕")
+	case ScenarioRefund:
+		tx.Amount = 1299
+		tx.Description = "AMAZON.CO.UK REFUND"
+		tx.Category = monzo.CategoryShopping
+		tx.Scheme = "mastercard"
+		tx.Settled = monzo.NullableTime{Time: now}
+		tx.IncludeInSpending = false
+		tx.Merchant = scenarioMerchant("Amazon", monzo.CategoryShopping, "📦")
+	case ScenarioDeclined:
+		tx.Amount = -2500
+		tx.Description = "TRAINLINE LONDON GBR"
+		tx.Category = monzo.CategoryTransport
+		tx.Scheme = "mastercard"
+		tx.DeclineReason = "INSUFFICIENT_FUNDS"
+		tx.Originator = true
+		tx.IncludeInSpending = false
+		tx.Merchant = scenarioMerchant("Trainline", monzo.CategoryTransport, "🚆")
+	case ScenarioFasterPaymentIn:
+		tx.Amount = 5000
+		tx.Description = "Rent share"
+		tx.Category = monzo.CategoryIncome
+		tx.Scheme = "payport_faster_payments"
+		tx.Settled = monzo.NullableTime{Time: now}
+		tx.IncludeInSpending = false
+		tx.Counterparty = &monzo.Counterparty{
+			Name:          "Alex Example",
+			SortCode:      "040004",
+			AccountNumber: "12345678",
+		}
+		tx.Metadata["faster_payment"] = "true"
+		tx.Metadata["notes"] = tx.Description
+		tx.Merchant = json.RawMessage("null")
+	default:
+		return monzo.Transaction{}, fmt.Errorf("webhooktest: unknown webhook scenario %q", scenario)
+	}
+
+	tx.LocalAmount = tx.Amount
+	tx.Categories = map[monzo.Category]int64{tx.Category: tx.Amount}
+	return tx, nil
+}
+
+// scenarioMerchant returns an expanded merchant for a scenario.
+func scenarioMerchant(name string, category monzo.Category, emoji string) json.RawMessage {
+	m, _ := json.Marshal(monzo.Merchant{
+		ID:       randomID("merch"),
+		GroupID:  randomID("grp"),
+		Name:     name,
+		Category: category,
+		Emoji:    emoji,
+		Created:  time.Date(2015, 8, 22, 12, 20, 18, 0, time.UTC),
+		Address:  monzo.Address{City: "London", Country: "GBR"},
+	})
+	return m
+}
+
+// randomID returns a random ID with the given prefix, like Monzo's.
+func randomID(prefix string) string {
+	b := make([]byte, 11)
+	crand.Read(b)
+	return prefix + "_0000" + hex.EncodeToString(b)
+}
+
+// NewWebhookEvent wraps a transaction in a webhook event of the given
+// type, e.g. monzo.WebhookTransactionUpdated.
+func NewWebhookEvent(eventType monzo.WebhookEventType, tx monzo.Transaction) (*monzo.WebhookEvent, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("webhooktest: encode transaction: %w", err)
+	}
+	return &monzo.WebhookEvent{Type: eventType, Data: data}, nil
+}
+
+// WebhookEventFor returns a new transaction.created event for a scenario.
+func WebhookEventFor(scenario Scenario, accountID string) (*monzo.WebhookEvent, error) {
+	tx, err := ScenarioTransaction(scenario, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebhookEvent(monzo.WebhookTransactionCreated, tx)
+}
+
+// SendOption configures SendWebhooks and DeliverWebhooks.
+type SendOption func(*sendConfig)
+
+type sendConfig struct {
+	redeliveries int
+	shuffle      bool
+	seed         uint64
+	client       *http.Client
+	targetURL    string
+	secret       string
+}
+
+// defaultTargetURL is the URL DeliverWebhooks requests by default.
+const defaultTargetURL = "http://webhooktest.invalid/webhook"
+
+// WithRedeliveries delivers every event n more times, as Monzo does when
+// it doesn't get a timely 200.
+func WithRedeliveries(n int) SendOption {
+	return func(cfg *sendConfig) {
+		cfg.redeliveries = n
+	}
+}
+
+// WithShuffle delivers events, including redeliveries, in a random order
+// chosen by seed, to simulate out-of-order arrival. The same seed always
+// gives the same order.
+func WithShuffle(seed uint64) SendOption {
+	return func(cfg *sendConfig) {
+		cfg.shuffle = true
+		cfg.seed = seed
+	}
+}
+
+// WithTargetURL sets the URL of the requests DeliverWebhooks serves, for
+// handlers that route on the path or read the query. It defaults to
+// http://webhooktest.invalid/webhook. SendWebhooks posts to its target
+// argument instead.
+func WithTargetURL(targetURL string) SendOption {
+	return func(cfg *sendConfig) {
+		cfg.targetURL = targetURL
+	}
+}
+
+// WithSecret adds secret to the URL of every delivery, as
+// monzo.Client.RegisterWebhookWithSecret does, so receivers using
+// monzo.WithWebhookSecret accept them.
+func WithSecret(secret string) SendOption {
+	return func(cfg *sendConfig) {
+		cfg.secret = secret
+	}
+}
+
+// WithHTTPClient sets the client SendWebhooks posts with. It defaults to
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) SendOption {
+	return func(cfg *sendConfig) {
+		cfg.client = client
+	}
+}
+
+// Delivery is the outcome of delivering one event.
+type Delivery struct {
+	// Event is the event delivered.
+	Event *monzo.WebhookEvent
+	// Attempt is 1 for the first delivery of Event, 2 for the first
+	// redelivery, and so on.
+	Attempt int
+	// StatusCode is the status the receiver responded with.
+	StatusCode int
+	// Err is set if the request couldn't be made.
+	Err error
+}
+
+// plan returns the deliveries to make for events, in order.
+func plan(events []*monzo.WebhookEvent, opts []SendOption) ([]Delivery, *sendConfig) {
+	cfg := &sendConfig{client: http.DefaultClient, targetURL: defaultTargetURL}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var deliveries []Delivery
+	for attempt := 1; attempt <= cfg.redeliveries+1; attempt++ {
+		for _, event := range events {
+			deliveries = append(deliveries, Delivery{Event: event, Attempt: attempt})
+		}
+	}
+	if cfg.shuffle {
+		r := rand.New(rand.NewPCG(cfg.seed, cfg.seed))
+		r.Shuffle(len(deliveries), func(i, j int) {
+			deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+		})
+		// Number attempts in the order they now arrive.
+		attempts := make(map[*monzo.WebhookEvent]int)
+		for i := range deliveries {
+			attempts[deliveries[i].Event]++
+			deliveries[i].Attempt = attempts[deliveries[i].Event]
+		}
+	}
+	return deliveries, cfg
+}
+
+// newWebhookRequest returns a POST request delivering event to target,
+// with the secret from cfg added.
+func newWebhookRequest(ctx context.Context, target string, event *monzo.WebhookEvent, cfg *sendConfig) (*http.Request, error) {
+	if cfg.secret != "" {
+		var err error
+		if target, err = monzo.WebhookURLWithSecret(target, cfg.secret); err != nil {
+			return nil, err
+		}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("webhooktest: encode webhook: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// SendWebhooks posts events to the webhook URL target, one at a time, and
+// returns the outcome of each delivery. It only returns an error if ctx
+// is done; failed deliveries are reported in their Delivery.
+func SendWebhooks(ctx context.Context, target string, events []*monzo.WebhookEvent, opts ...SendOption) ([]Delivery, error) {
+	deliveries, cfg := plan(events, opts)
+	for i := range deliveries {
+		if err := ctx.Err(); err != nil {
+			return deliveries[:i], err
+		}
+		d := &deliveries[i]
+
+		req, err := newWebhookRequest(ctx, target, d.Event, cfg)
+		if err != nil {
+			d.Err = err
+			continue
+		}
+		resp, err := cfg.client.Do(req)
+		if err != nil {
+			d.Err = err
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		d.StatusCode = resp.StatusCode
+	}
+	return deliveries, nil
+}
+
+// DeliverWebhooks serves events to h, one at a time, without a network,
+// and returns the outcome of each delivery.
+func DeliverWebhooks(h http.Handler, events []*monzo.WebhookEvent, opts ...SendOption) []Delivery {
+	deliveries, cfg := plan(events, opts)
+	for i := range deliveries {
+		d := &deliveries[i]
+
+		req, err := newWebhookRequest(context.Background(), cfg.targetURL, d.Event, cfg)
+		if err != nil {
+			d.Err = err
+			continue
+		}
+		rec := &statusRecorder{header: make(http.Header)}
+		h.ServeHTTP(rec, req)
+		d.StatusCode = rec.status()
+	}
+	return deliveries
+}
+
+// statusRecorder is an http.ResponseWriter that records the status and
+// discards the body.
+type statusRecorder struct {
+	header http.Header
+	code   int
+}
+
+func (r *statusRecorder) Header() http.Header { return r.header }
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+// status returns the status written, which is 200 if the handler wrote
+// nothing.
+func (r *statusRecorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
@@ -0,0 +1,170 @@
+package webhooktest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/petermakeswebsites/go-monzo/monzo"
+)
+
+func TestScenarios(t *testing.T) {
+	for _, scenario := range Scenarios() {
+		event, err := WebhookEventFor(scenario, "acc_001")
+		if err != nil {
+			t.Fatalf("%s: WebhookEventFor returned an error: %v", scenario, err)
+		}
+		req, err := newWebhookRequest(context.Background(), defaultTargetURL, event, &sendConfig{})
+		if err != nil {
+			t.Fatalf("%s: newWebhookRequest returned an error: %v", scenario, err)
+		}
+		tx, err := monzo.ParseWebhookTransactionCreated(req, monzo.WithStrictWebhookDecoding())
+		if err != nil {
+			t.Fatalf("%s: ParseWebhookTransactionCreated returned an error: %v", scenario, err)
+		}
+		if tx.AccountID != "acc_001" || tx.Amount == 0 {
+			t.Errorf("%s: unexpected transaction %+v", scenario, tx)
+		}
+
+		switch scenario {
+		case ScenarioCardPayment:
+			if m, ok := tx.ExpandedMerchant(); !ok || m.Name == "" || tx.Settled.Valid() {
+				t.Errorf("%s: expected a pending payment with a merchant, got %+v", scenario, tx)
+			}
+		case ScenarioDeclined:
+			if tx.DeclineReason == "" {
+				t.Errorf("%s: expected a decline reason", scenario)
+			}
+		case ScenarioFasterPaymentIn:
+			if tx.Counterparty == nil || tx.Amount <= 0 {
+				t.Errorf("%s: expected an incoming payment with a counterparty, got %+v", scenario, tx)
+			}
+		}
+	}
+
+	if _, err := WebhookEventFor("direct-debit-bounce", "acc_001"); err == nil {
+		t.Error("expected an error for an unknown scenario")
+	}
+}
+
+func TestDeliverWebhooks_RedeliveryAndShuffle(t *testing.T) {
+	var events []*monzo.WebhookEvent
+	for _, scenario := range Scenarios() {
+		event, err := WebhookEventFor(scenario, "acc_001")
+		if err != nil {
+			t.Fatalf("WebhookEventFor returned an error: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	h := monzo.NewWebhookHandler(monzo.WithWebhookDeduper(monzo.NewMemoryDeduper(100, time.Hour)))
+	handled := map[string]int{}
+	h.OnTransactionCreated(func(ctx context.Context, tx *monzo.Transaction) error {
+		handled[tx.ID]++
+		return nil
+	})
+
+	deliveries := DeliverWebhooks(h, events, WithRedeliveries(2), WithShuffle(42))
+	if len(deliveries) != 3*len(events) {
+		t.Fatalf("expected %d deliveries, got %d", 3*len(events), len(deliveries))
+	}
+	inOrder := true
+	for i, d := range deliveries {
+		if d.StatusCode != http.StatusOK {
+			t.Errorf("delivery %d: expected status 200, got %d", i, d.StatusCode)
+		}
+		if i < len(events) && d.Event != events[i] {
+			inOrder = false
+		}
+	}
+	if inOrder {
+		t.Error("expected shuffled deliveries")
+	}
+	if len(handled) != len(events) {
+		t.Errorf("expected %d transactions handled, got %d", len(events), len(handled))
+	}
+	for id, n := range handled {
+		if n != 1 {
+			t.Errorf("expected %s to be handled once, got %d", id, n)
+		}
+	}
+
+	again := DeliverWebhooks(http.NotFoundHandler(), events, WithRedeliveries(2), WithShuffle(42))
+	for i := range again {
+		if again[i].Event != deliveries[i].Event || again[i].Attempt != deliveries[i].Attempt {
+			t.Fatal("expected the same seed to give the same order")
+		}
+	}
+}
+
+func TestSendWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	var received []monzo.WebhookEventType
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event, err := monzo.ParseWebhookEvent(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, event.Type)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	tx, err := ScenarioTransaction(ScenarioCardPayment, "acc_001")
+	if err != nil {
+		t.Fatalf("ScenarioTransaction returned an error: %v", err)
+	}
+	created, _ := NewWebhookEvent(monzo.WebhookTransactionCreated, tx)
+	tx.Settled = monzo.NullableTime{Time: time.Now()}
+	updated, _ := NewWebhookEvent(monzo.WebhookTransactionUpdated, tx)
+
+	deliveries, err := SendWebhooks(context.Background(), srv.URL, []*monzo.WebhookEvent{created, updated}, WithRedeliveries(1))
+	if err != nil {
+		t.Fatalf("SendWebhooks returned an error: %v", err)
+	}
+	for _, d := range deliveries {
+		if d.Err != nil || d.StatusCode != http.StatusOK {
+			t.Errorf("unexpected delivery: %+v", d)
+		}
+	}
+	want := []monzo.WebhookEventType{monzo.WebhookTransactionCreated, monzo.WebhookTransactionUpdated, monzo.WebhookTransactionCreated, monzo.WebhookTransactionUpdated}
+	if len(received) != len(want) {
+		t.Fatalf("expected %d deliveries, got %d", len(want), len(received))
+	}
+	for i := range want {
+		if received[i] != want[i] {
+			t.Errorf("delivery %d: expected %s, got %s", i, want[i], received[i])
+		}
+	}
+}
+
+func TestDeliverWebhooks_Secret(t *testing.T) {
+	event, err := WebhookEventFor(ScenarioCardPayment, "acc_001")
+	if err != nil {
+		t.Fatalf("WebhookEventFor returned an error: %v", err)
+	}
+	h := monzo.NewWebhookHandler(monzo.WithWebhookSecret("s3cret"))
+	mux := http.NewServeMux()
+	mux.Handle("POST /hooks/monzo", h)
+
+	events := []*monzo.WebhookEvent{event}
+	if d := DeliverWebhooks(mux, events, WithTargetURL("http://example.com/hooks/monzo")); d[0].StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403 without the secret, got %d", d[0].StatusCode)
+	}
+	d := DeliverWebhooks(mux, events, WithTargetURL("http://example.com/hooks/monzo"), WithSecret("s3cret"))
+	if d[0].Err != nil || d[0].StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 with the secret, got %+v", d[0])
+	}
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	sent, err := SendWebhooks(context.Background(), srv.URL+"/hooks/monzo", events, WithSecret("s3cret"))
+	if err != nil || sent[0].StatusCode != http.StatusOK {
+		t.Errorf("expected SendWebhooks to add the secret, got %+v, %v", sent[0], err)
+	}
+}